@@ -0,0 +1,135 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+Compiles a grammar into a standalone Go parser.
+
+	semiparse-gen [flags] importpath.RegisterFunc...
+
+The grammar is assembled by calling each RegisterFunc (with the signature
+func(*parser.Parser)) on a fresh Parser, in the given order. Example:
+
+	semiparse-gen -pkg cparse -importpath github.com/byte-mug/semiparse/cparse -o gen_expr.go \
+		github.com/byte-mug/semiparse/cparse.RegisterExpr
+
+Since the grammar only exists as Go code, semiparse-gen writes a small
+program, that builds the grammar and passes it to package gen, and runs it
+with "go run".
+*/
+package main
+
+import "flag"
+import "fmt"
+import "os"
+import "os/exec"
+import "path/filepath"
+import "strings"
+import "text/template"
+
+var (
+	output     = flag.String("o","-","output file")
+	pkg        = flag.String("pkg","main","package name of the generated code")
+	importPath = flag.String("importpath","","import path of the generated code's package")
+	prefix     = flag.String("prefix","g_","prefix for generated identifiers")
+	register   = flag.String("register","Register","name of the generated registration function")
+)
+
+var driver = template.Must(template.New("driver").Parse(`package main
+
+import "os"
+import "fmt"
+import "github.com/byte-mug/semiparse/parser"
+import "github.com/byte-mug/semiparse/gen"
+{{range $i,$r := .Regs}}import r{{$i}} {{printf "%q" $r.Path}}
+{{end}}
+func main() {
+	p := new(parser.Parser).Construct()
+{{range $i,$r := .Regs}}	r{{$i}}.{{$r.Func}}(p)
+{{end}}	cfg := gen.Config{Package:{{printf "%q" .Pkg}},ImportPath:{{printf "%q" .ImportPath}},Prefix:{{printf "%q" .Prefix}},Register:{{printf "%q" .Register}}}
+	if err := cfg.Generate(os.Stdout,p); err!=nil {
+		fmt.Fprintln(os.Stderr,err)
+		os.Exit(1)
+	}
+}
+`))
+
+type registration struct{
+	Path string
+	Func string
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr,"semiparse-gen:",err)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr,"usage: semiparse-gen [flags] importpath.RegisterFunc...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg()==0 { flag.Usage(); os.Exit(2) }
+	
+	var regs []registration
+	for _,a := range flag.Args() {
+		i := strings.LastIndex(a,".")
+		if i<=strings.LastIndex(a,"/") { fail(fmt.Errorf("invalid registration %q, expected importpath.Func",a)) }
+		regs = append(regs,registration{a[:i],a[i+1:]})
+	}
+	
+	dir,err := os.MkdirTemp("","semiparse-gen")
+	if err!=nil { fail(err) }
+	defer os.RemoveAll(dir)
+	
+	file := filepath.Join(dir,"main.go")
+	f,err := os.Create(file)
+	if err!=nil { fail(err) }
+	err = driver.Execute(f,map[string]interface{}{
+		"Regs": regs,
+		"Pkg": *pkg,
+		"ImportPath": *importPath,
+		"Prefix": *prefix,
+		"Register": *register,
+	})
+	f.Close()
+	if err!=nil { fail(err) }
+	
+	out := os.Stdout
+	if *output!="-" {
+		out,err = os.Create(*output+".tmp")
+		if err!=nil { fail(err) }
+	}
+	cmd := exec.Command("go","run",file)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if *output!="-" {
+		out.Close()
+		if err!=nil { os.Remove(*output+".tmp") ; fail(err) }
+		if err = os.Rename(*output+".tmp",*output); err!=nil { fail(err) }
+	} else if err!=nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/gob"
+import "path/filepath"
+import "bytes"
+import "fmt"
+import "io"
+import "os"
+
+/*
+The AST types are registered with encoding/gob under stable names, so that
+they can be stored within interface{} values (like Expr.Data).
+*/
+func init() {
+	gob.RegisterName("cparse.Expr",&Expr{})
+	gob.RegisterName("cparse.DType",&DType{})
+	gob.RegisterName("cparse.Statement",&Statement{})
+	gob.RegisterName("cparse.VarDecl",VarDecl{})
+	gob.RegisterName("cparse.ParamDecl",ParamDecl{})
+	gob.RegisterName("cparse.DeclProtoFunc",&DeclProtoFunc{})
+	gob.RegisterName("cparse.DeclImplFunc",&DeclImplFunc{})
+	gob.RegisterName("cparse.DeclInclude",&DeclInclude{})
+	gob.RegisterName("cparse.DeclCType",&DeclCType{})
+	gob.RegisterName("cparse.DeclInfix",&DeclInfix{})
+	gob.RegisterName("[]interface{}",[]interface{}{})
+}
+
+// The version of the serialization format. Increment on changes of the AST types.
+const astVersion = 1
+
+type astFile struct{
+	Version int
+	AST interface{}
+}
+
+// Serializes an AST (or a slice of ASTs), as returned by the cparse rules.
+func EncodeAST(w io.Writer, ast interface{}) error {
+	return gob.NewEncoder(w).Encode(astFile{astVersion,ast})
+}
+
+// Deserializes an AST, written by EncodeAST().
+func DecodeAST(r io.Reader) (interface{},error) {
+	var f astFile
+	if err := gob.NewDecoder(r).Decode(&f); err!=nil { return nil,err }
+	if f.Version!=astVersion { return nil,fmt.Errorf("cparse: AST version %d, expected %d",f.Version,astVersion) }
+	return f.AST,nil
+}
+
+/*
+A persistent cache of parsed declarations, stored as files in Dir. Entries are
+keyed by the hash of the source, its file name and the fingerprint of the
+grammar (see parser.Parser.Fingerprint()). As the fingerprint doesn't cover
+the code of Pfuncs, Salt should be changed, whenever that changes.
+*/
+type Cache struct{
+	Dir string
+	Salt string
+	
+	// Tokenizes the source. Defaults to a BaseScanner with CKeywords and COperators.
+	Scan func(filename string, src []byte) *scanlist.Element
+}
+
+// Returns the cache key for src.
+func (c *Cache) Key(p *parser.Parser,filename string, src []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h,"%d\n%q\n%q\n%s\n",astVersion,c.Salt,filename,p.Fingerprint())
+	h.Write(src)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) path(key string) string { return filepath.Join(c.Dir,key+".ast") }
+
+// Loads the declarations, stored under key.
+func (c *Cache) Load(key string) ([]interface{},bool) {
+	f,err := os.Open(c.path(key))
+	if err!=nil { return nil,false }
+	defer f.Close()
+	ast,err := DecodeAST(f)
+	if err!=nil { return nil,false }
+	decls,ok := ast.([]interface{})
+	return decls,ok
+}
+
+// Stores the declarations under key.
+func (c *Cache) Store(key string,decls []interface{}) error {
+	buf := new(bytes.Buffer)
+	if err := EncodeAST(buf,decls); err!=nil { return err }
+	if err := os.MkdirAll(c.Dir,0755); err!=nil { return err }
+	tmp,err := os.CreateTemp(c.Dir,key+".*.tmp")
+	if err!=nil { return err }
+	_,err = tmp.Write(buf.Bytes())
+	if e := tmp.Close(); err==nil { err = e }
+	if err==nil { err = os.Rename(tmp.Name(),c.path(key)) }
+	if err!=nil { os.Remove(tmp.Name()) }
+	return err
+}
+
+/*
+Like ParseDeclarations(), but loads the result from the cache, if present, and
+stores it otherwise. Failed parses are not cached.
+*/
+func (c *Cache) ParseDeclarations(p *parser.Parser,filename string, src []byte) parser.ParserResult {
+	key := c.Key(p,filename,src)
+	if decls,ok := c.Load(key); ok { return parser.ResultOk(nil,decls) }
+	
+	scan := c.Scan
+	if scan==nil { scan = c_scan }
+	res := ParseDeclarations(p,scan(filename,src))
+	if res.Ok() { c.Store(key,res.Data.([]interface{})) }
+	return res
+}
+
+func c_scan(filename string, src []byte) *scanlist.Element {
+	s := NewScanner(bytes.NewReader(src))
+	s.Filename = filename
+	return s.Next()
+}
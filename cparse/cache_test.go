@@ -0,0 +1,127 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "encoding/gob"
+import "path/filepath"
+import "reflect"
+import "bytes"
+import "os"
+import "testing"
+
+const cacheSrc = `#cinclude "stdio.h"
+#ctype myint "int"
+#infixl 6 "<+>"
+int f(int a, char b);
+int g(int a) { int x = a <+> 3, y; if (x) y = -x; x = (char*)y; }
+`
+
+// Collects the names of the cparse types within v.
+func astTypes(v reflect.Value,names map[string]bool) {
+	switch v.Kind() {
+	case reflect.Interface,reflect.Ptr:
+		if !v.IsNil() { astTypes(v.Elem(),names) }
+	case reflect.Slice:
+		for i := 0; i<v.Len(); i++ { astTypes(v.Index(i),names) }
+	case reflect.Struct:
+		if v.Type().PkgPath()==reflect.TypeOf(Expr{}).PkgPath() { names[v.Type().Name()] = true }
+		for i := 0; i<v.NumField(); i++ { astTypes(v.Field(i),names) }
+	}
+}
+
+func encode(t *testing.T,ast interface{}) []byte {
+	buf := new(bytes.Buffer)
+	if err := EncodeAST(buf,ast); err!=nil { t.Fatal(err) }
+	return buf.Bytes()
+}
+
+// Every registered AST type survives an encode/decode round trip.
+func TestASTRoundTrip(t *testing.T) {
+	r := ParseDeclarations(newParser(),lex(cacheSrc))
+	if !r.Ok() { t.Fatal(r.Data) }
+	b := encode(t,r.Data)
+	ast,err := DecodeAST(bytes.NewReader(b))
+	if err!=nil { t.Fatal(err) }
+	names := make(map[string]bool)
+	astTypes(reflect.ValueOf(ast),names)
+	for _,n := range []string{"Expr","DType","Statement","VarDecl","ParamDecl","DeclProtoFunc","DeclImplFunc","DeclInclude","DeclCType","DeclInfix"} {
+		if !names[n] { t.Errorf("no %s in the decoded AST",n) }
+	}
+	// Encoding the decoded AST gives the same bytes, if nothing has been lost.
+	if !bytes.Equal(encode(t,ast),b) { t.Error("the decoded AST differs") }
+}
+
+func TestASTVersion(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(astFile{astVersion+1,[]interface{}{}}); err!=nil { t.Fatal(err) }
+	if _,err := DecodeAST(bytes.NewReader(buf.Bytes())); err==nil { t.Error("no error") }
+	
+	// The cache ignores such files.
+	c := &Cache{Dir:t.TempDir()}
+	p := newParser()
+	key := c.Key(p,"a.c",[]byte(cacheSrc))
+	if err := os.WriteFile(filepath.Join(c.Dir,key+".ast"),buf.Bytes(),0644); err!=nil { t.Fatal(err) }
+	if _,ok := c.Load(key); ok { t.Error("loaded a file of another version") }
+	if r := c.ParseDeclarations(p,"a.c",[]byte(cacheSrc)); !r.Ok() || len(r.Data.([]interface{}))!=5 { t.Errorf("got %v",r.Data) }
+	if _,ok := c.Load(key); !ok { t.Error("the file hasn't been replaced") }
+}
+
+func TestCache(t *testing.T) {
+	scans := 0
+	c := &Cache{Dir:t.TempDir(),Scan:func(filename string, src []byte) *scanlist.Element {
+		scans++
+		return c_scan(filename,src)
+	}}
+	parse := func(p *parser.Parser,filename,src string) []byte {
+		r := c.ParseDeclarations(p,filename,[]byte(src))
+		if !r.Ok() { return nil }
+		return encode(t,r.Data)
+	}
+	p := newParser()
+	want := parse(p,"a.c",cacheSrc)
+	if scans!=1 || want==nil { t.Fatalf("miss: %d scans",scans) }
+	if got := parse(p,"a.c",cacheSrc); scans!=1 || !bytes.Equal(got,want) { t.Errorf("hit: %d scans",scans) }
+	
+	// The source, the file name, the salt and the grammar are part of the key.
+	for i,f := range []func(){
+		func() { parse(p,"a.c",cacheSrc+"int h(int a);") },
+		func() { parse(p,"b.c",cacheSrc) },
+		func() { c.Salt = "v2"; parse(p,"a.c",cacheSrc) },
+		func() { q := newParser(); q.Define("Extra",false,parser.Literal("x")); parse(q,"a.c",cacheSrc) },
+	} {
+		n := scans
+		f()
+		if scans!=n+1 { t.Errorf("%d: no miss",i) }
+	}
+	
+	// Failed parses aren't stored.
+	parse(p,"c.c","int ;")
+	parse(p,"c.c","int ;")
+	if n := scans; n!=7 { t.Errorf("%d scans",n) }
+	files,_ := filepath.Glob(filepath.Join(c.Dir,"*"))
+	if len(files)!=5 { t.Errorf("files: %v",files) }
+}
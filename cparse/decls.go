@@ -50,9 +50,41 @@ type DeclImplFunc struct{
 	Body interface{}
 	Pos scanner.Position
 }
+// Implements parser.PosShifter, so parser.Document can reuse it.
+func (d *DeclProtoFunc) ShiftPos(s parser.PosShift) (interface{},bool) {
+	t,ok := s.Data(d.Type)
+	if !ok { return nil,false }
+	a,ok := c_shift_params(s,d.Arguments)
+	if !ok { return nil,false }
+	return &DeclProtoFunc{t,d.Name,a,s.Pos(d.Pos)},true
+}
+
+// Implements parser.PosShifter, so parser.Document can reuse it.
+func (d *DeclImplFunc) ShiftPos(s parser.PosShift) (interface{},bool) {
+	t,ok := s.Data(d.Type)
+	if !ok { return nil,false }
+	a,ok := c_shift_params(s,d.Arguments)
+	if !ok { return nil,false }
+	b,ok := s.Data(d.Body)
+	if !ok { return nil,false }
+	return &DeclImplFunc{t,d.Name,a,b,s.Pos(d.Pos)},true
+}
+
+func c_shift_params(s parser.PosShift,ps []ParamDecl) ([]ParamDecl,bool) {
+	c := make([]ParamDecl,len(ps))
+	for i,p := range ps {
+		t,ok := s.Data(p.Type)
+		if !ok { return nil,false }
+		c[i] = ParamDecl{t,p.Name}
+	}
+	return c,true
+}
+
 type DeclInclude struct{
 	HdrName string
 }
+// Implements parser.PosShifter; it has no positions.
+func (d *DeclInclude) ShiftPos(s parser.PosShift) (interface{},bool) { return d,true }
 func (d *DeclInclude) String() string {
 	return fmt.Sprint("#include <",d.HdrName,">")
 }
@@ -61,34 +93,50 @@ type DeclCType struct{
 	Inner string
 	CType string
 }
+// Implements parser.PosShifter; it has no positions.
+func (d *DeclCType) ShiftPos(s parser.PosShift) (interface{},bool) { return d,true }
 func (d *DeclCType) String() string {
 	return fmt.Sprint(d.Inner," : ",d.CType)
 }
 
+// #infixl 6 "<+>"
+type DeclInfix struct{
+	Operator
+}
+// Implements parser.PosShifter; it has no positions.
+func (d *DeclInfix) ShiftPos(s parser.PosShift) (interface{},bool) { return d,true }
+func (d *DeclInfix) String() string {
+	dir := "#infixl"
+	switch d.Assoc {
+	case ASSOC_RIGHT: dir = "#infixr"
+	case ASSOC_NONE: dir = "#infix"
+	}
+	return fmt.Sprint(dir," ",d.Prec," ",strconv.Quote(d.Text))
+}
+
 type DeclNone struct{}
 
 
 
 func C_DeclFragment_Func(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	ars := parser.ArraySeq{
-		parser.Delegate("Type"),
-		parser.Required{scanner.Ident,parser.Textify},
-		parser.Required{'('/*)*/,parser.Textify},
-	}.Parse(p,tokens,left)
-	if !ars.Ok() { return ars }
+	ars := parser.Seq3(
+		parser.DelegateT[interface{}]("Type"),
+		parser.Token(scanner.Ident),
+		parser.Token('('/*)*/),
+	)(p,tokens)
+	if !ars.Ok() { return ars.ParserResult }
 	t := ars.Next
-	itr := ars.Data.([]interface{})
+	itr := ars.Value
 	
 	args := []ParamDecl{}
 	if t.SafeToken()!=/*(*/')' {
 		for{
-			vd := parser.ArraySeq{
-				parser.Delegate("Type"),
-				parser.Required{scanner.Ident,parser.Textify},
-			}.Parse(p,t,left)
-			if !vd.Ok() { return ars }
-			itr := vd.Data.([]interface{})
-			args = append(args,ParamDecl{itr[0],itr[1].(string)})
+			vd := parser.Seq2(
+				parser.DelegateT[interface{}]("Type"),
+				parser.Token(scanner.Ident),
+			)(p,t)
+			if !vd.Ok() { return parser.ResultOk(ars.Next,[]interface{}{itr.First,itr.Second,itr.Third}) }
+			args = append(args,ParamDecl{vd.Value.First,vd.Value.Second})
 			t = vd.Next.SafeNext()
 			if vd.Next.SafeToken()==',' { continue }
 			if vd.Next.SafeToken()!=/*(*/')' {
@@ -98,7 +146,7 @@ func C_DeclFragment_Func(p *parser.Parser,tokens *scanlist.Element, left interfa
 			break
 		}
 	}
-	return parser.ResultOk(t,&DeclProtoFunc{itr[0],itr[1].(string),args,tokens.Pos})
+	return parser.ResultOk(t,&DeclProtoFunc{itr.First,itr.Second,args,tokens.Pos})
 }
 
 func c_declaration_func(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
@@ -157,11 +205,40 @@ func c_declaration_libprep(p *parser.Parser,tokens *scanlist.Element, left inter
 		return vd
 	}
 	
+	vd = parser.ArraySeq{
+		parser.Required{'#',parser.Textify},
+		parser.OR{
+			parser.RequireText{"infixl"},
+			parser.RequireText{"infixr"},
+			parser.RequireText{"infix"},
+		},
+		parser.Required{scanner.Int,parser.Textify},
+		parser.Required{scanner.String,parser.Textify},
+	}.Parse(p,tokens,left)
+	if vd.Ok() {
+		i := vd.Data.([]interface{})
+		d := new(DeclInfix)
+		switch i[1].(string) {
+		case "infixr": d.Assoc = ASSOC_RIGHT
+		case "infix": d.Assoc = ASSOC_NONE
+		}
+		prec,err := strconv.Atoi(i[2].(string))
+		if err!=nil { return parser.ResultFail(fmt.Sprint(err),tokens.Next().Next().SafePos()) }
+		d.Prec = prec
+		d.Text,err = strconv.Unquote(i[3].(string))
+		if err!=nil || d.Text=="" { return parser.ResultFail("Invalid operator",tokens.Next().Next().Next().SafePos()) }
+		
+		// Subsequent expressions see the new operator.
+		Operators(p).Declare(d.Text,d.Prec,d.Assoc)
+		vd.Data = d
+		return vd
+	}
+	
 	return parser.ResultFail("Next Rule!",tokens.SafePos())
 }
 
 func RegisterDeclaration(p *parser.Parser) {
-	p.Define("Declaration",false,parser.Pfunc(c_declaration_func))
-	p.Define("Declaration",false,parser.Pfunc(c_declaration_libprep))
+	p.Define("Declaration",false,parser.Pfunc(c_declaration_func).FirstAs(parser.Delegate("Type")))
+	p.Define("Declaration",false,parser.Pfunc(c_declaration_libprep).First('#'))
 }
 
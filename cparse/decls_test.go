@@ -0,0 +1,54 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "github.com/byte-mug/semiparse/parser"
+import "fmt"
+import "testing"
+
+func TestDeclFragmentFunc(t *testing.T) {
+	p := newParser()
+	for _,c := range []struct{ src,want,next string }{
+		{"int f(int a, char b);", "*cparse.DeclProtoFunc f 2", ";"},
+		// A parameter, that doesn't parse, yields the fragment up to the '('.
+		{"int f(int a, );",       "[]interface {} f 3", "int"},
+		{"int f(3);",             "[]interface {} f 3", "3"},
+		{"int f(int a b);",       "Unexpected <<Ident>>, expected ',' or ')'", ""},
+		{"int 3",                 "Unexpected <<Int>>, expected <<Ident>>", ""},
+	} {
+		r := C_DeclFragment_Func(p,lex(c.src),nil)
+		got,next := "",""
+		switch d := r.Data.(type) {
+		case *DeclProtoFunc: got = fmt.Sprintf("%T %s %d",d,d.Name,len(d.Arguments))
+		case []interface{}: got = fmt.Sprintf("%T %v %d",d,d[1],len(d))
+		default: got = fmt.Sprint(d)
+		}
+		if r.Ok() { next = r.Next.SafeTokenText() }
+		if got!=c.want || next!=c.next { t.Errorf("%q: got %s, next %q, want %s, next %q",c.src,got,next,c.want,c.next) }
+	}
+	
+	// A declaration with such a fragment fails.
+	if r := p.Match("Declaration",lex("int f(int a, );")); r.Result!=parser.RESULT_FAILED { t.Errorf("got %v %v",r.Result,r.Data) }
+}
@@ -0,0 +1,58 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "text/scanner"
+import "reflect"
+import "io"
+import "testing"
+
+// The AST is moved behind an edit, so the result equals the one of a full parse.
+func TestDocument(t *testing.T) {
+	p := newParser()
+	scan := func(src io.Reader,base scanner.Position) *scanlist.Element {
+		s := NewScanner(src)
+		s.Base = base
+		return s.Next()
+	}
+	p.Define("File",false,parser.ArrayStar{parser.Delegate("Declaration")})
+	doc := &parser.Document{Parser:p,Rule:"File",Scan:scan,MemoizeAll:true}
+	doc.SetText([]byte("int f(int a) {\n\tint b = a*2, c;\n\treturn b;\n}\n#cinclude \"a.h\"\nchar *g(char const *s) { if (s) s++; else s--; }\n"))
+	for _,c := range []struct{
+		offset,length int
+		text string
+	}{
+		{0,0,"int h(int x);\n"},
+		{20,1,"xyz"},
+		{15,0,"\n\n"},
+		{0,14,""},
+	}{
+		res := doc.Edit(c.offset,c.length,c.text)
+		want := (&parser.Document{Parser:p,Rule:"File",Scan:scan}).SetText(doc.Text)
+		if !res.Ok() || !reflect.DeepEqual(res.Data,want.Data) { t.Errorf("%q: got %v, want %v",doc.Text,res.Data,want.Data) }
+	}
+}
@@ -58,12 +58,26 @@ func aR(i ...interface{}) []interface{} { return i }
 /* When in doubt, use this! */
 var pOS = scanner.Position{}
 
+// Like s.Data(d), for the Data of the AST nodes.
+func c_shift(s parser.PosShift,d []interface{}) ([]interface{},bool) {
+	c,ok := s.Data(d)
+	if !ok { return nil,false }
+	return c.([]interface{}),true
+}
+
 type Expr struct{
 	Type uint
 	Text string
 	Data []interface{}
 	Pos scanner.Position
 }
+// Implements parser.PosShifter, so parser.Document can reuse it.
+func (e *Expr) ShiftPos(s parser.PosShift) (interface{},bool) {
+	if e==nil { return e,true }
+	d,ok := c_shift(s,e.Data)
+	if !ok { return nil,false }
+	return &Expr{e.Type,e.Text,d,s.Pos(e.Pos)},true
+}
 func (e *Expr) String() string {
 	if e==nil { return "NIL" }
 	switch e.Type {
@@ -131,34 +145,51 @@ func c_expr0(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser
 	case scanner.Float: return parser.ResultOk(tokens.Next(),&Expr{E_FLOAT,tokens.TokenText,nil,tokens.Pos})
 	case scanner.Char: return parser.ResultOk(tokens.Next(),&Expr{E_CHAR,tokens.TokenText,nil,tokens.Pos})
 	case scanner.String,scanner.RawString: return parser.ResultOk(tokens.Next(),&Expr{E_STRING,tokens.TokenText,nil,tokens.Pos})
-	case '*','+','-','!','~','&':{
-		sub := p.MatchNoLeftRecursion("Expr0",tokens.Next())
-		if sub.Result==parser.RESULT_OK {
-			sub.Data = &Expr{E_UNARY_OP,tokens.TokenText,aR(sub.Data),tokens.Pos}
-		}
-		return sub
-	    }
-	case '(': /*)*/{
-		sub := p.Match("Expr",tokens.Next())
-		if sub.Result==parser.RESULT_OK {/*(*/
-			e,t := parser.Match(parser.Textify,sub.Next,')')
-			if e!=nil { return parser.ResultFail(fmt.Sprint(e),sub.Next.SafePos()) }
-			sub.Next = t
-		}
-		return sub
-	    }
 	}
 	return parser.ResultFail("Invalid Expression!",tokens.Pos)
 }
+
+/*
+The unary operators and parentheses are built from combinators rather than
+Pfuncs, so that they nest without recursion in the iterative engine.
+*/
+
+// Op Expr => E_UNARY_OP
+func c_expr_unary(res parser.ParserResult,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	if res.Result==parser.RESULT_OK {
+		res.Data = &Expr{E_UNARY_OP,tokens.TokenText,aR(res.Data),tokens.Pos}
+	}
+	return res
+}
+
+// '(' Expr ')' => Expr
+func c_expr_paren(res parser.ParserResult,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	if res.Result==parser.RESULT_OK {/*(*/
+		e,t := parser.Match(parser.Textify,res.Next,')')
+		if e!=nil { return parser.ResultFail(fmt.Sprint(e),res.Next.SafePos()) }
+		res.Next = t
+	}
+	return res
+}
+
+// Unary operators, applied on the rule n.
+func c_expr_unary_cases(n string) map[rune]parser.ParseRule {
+	m := make(map[rune]parser.ParseRule)
+	for _,op := range []rune{'*','+','-','!','~','&',C_INC,C_DEC} {
+		m[op] = parser.Action{parser.LSeq{parser.Required{op,parser.Textify},parser.DelegateNoLeftRecursion(n)},c_expr_unary}
+	}
+	return m
+}
 func c_expr_trailer0(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	if ok,t := parser.FastMatch(tokens,'+','+'); ok {
+	if c_user_op(p,tokens) { return parser.ResultFail("No trailer.",tokens.SafePos()) }
+	if ok,t := parser.FastMatch(tokens,C_INC); ok {
 		return parser.ResultOk(t,&Expr{E_INCR,"++",aR(left),tokens.Pos})
 	}
-	if ok,t := parser.FastMatch(tokens,'-','-'); ok {
+	if ok,t := parser.FastMatch(tokens,C_DEC); ok {
 		return parser.ResultOk(t,&Expr{E_DECR,"--",aR(left),tokens.Pos})
 	}
-	if ok,t := parser.FastMatch(tokens,'-','>',scanner.Ident); ok {
-		return parser.ResultOk(t,&Expr{E_FIELD_PTR,tokens.Next().Next().TokenText,aR(left),tokens.Pos})
+	if ok,t := parser.FastMatch(tokens,C_ARROW,scanner.Ident); ok {
+		return parser.ResultOk(t,&Expr{E_FIELD_PTR,tokens.Next().TokenText,aR(left),tokens.Pos})
 	}
 	if ok,t := parser.FastMatch(tokens,'.',scanner.Ident); ok {
 		return parser.ResultOk(t,&Expr{E_FIELD_DOT,tokens.Next().TokenText,aR(left),tokens.Pos})
@@ -187,164 +218,19 @@ func c_expr_trailer0(p *parser.Parser,tokens *scanlist.Element, left interface{}
 	return parser.ResultFail("No trailer.",tokens.SafePos())
 }
 
-func c_expr1(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	if tokens==nil { return parser.ResultFail("EOF!",scanner.Position{}) }
-	switch tokens.Token {
-	case '*','+','-','!','~','&':{
-		sub := p.MatchNoLeftRecursion("Expr1",tokens.Next())
-		if sub.Result==parser.RESULT_OK {
-			sub.Data = &Expr{E_UNARY_OP,tokens.TokenText,aR(sub.Data),tokens.Pos}
-		}
-		return sub
-	    }
-	}
-	return p.Match("Expr0",tokens)
-}
-func c_expr2(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	return p.Match("Expr1",tokens)
-}
-func c_expr3(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	return p.Match("Expr2",tokens)
-}
-func c_expr_trailer3(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	ok,t := parser.FastMatch(tokens,'*')
-	if !ok { ok,t = parser.FastMatch(tokens,'/') }
-	if !ok { ok,t = parser.FastMatch(tokens,'%') }
-	
-	if ok {
-		s := tokens.TokenText
-		op := E_BINARY_OP
-		if t.SafeToken()=='=' {
-			op = E_BINARY_OP_ASSIGN
-			t = t.SafeNext()
-		}
-		sub := p.MatchNoLeftRecursion("Expr3",t)
-		if sub.Result==parser.RESULT_OK {
-			sub.Data = &Expr{op,s,aR(left,sub.Data),tokens.Pos}
-		}
-		return sub
-	}
-	return parser.ResultFail("No trailer.",tokens.SafePos())
-}
-
-func c_expr4(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	return p.Match("Expr3",tokens)
-}
-func c_expr_trailer4(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	ok,t := parser.FastMatch(tokens,'+')
-	if !ok { ok,t = parser.FastMatch(tokens,'-') }
-	
-	if ok {
-		s := tokens.TokenText
-		op := E_BINARY_OP
-		if t.SafeToken()=='=' {
-			op = E_BINARY_OP_ASSIGN
-			t = t.SafeNext()
-		}
-		sub := p.MatchNoLeftRecursion("Expr4",t)
-		if sub.Result==parser.RESULT_OK {
-			sub.Data = &Expr{op,s,aR(left,sub.Data),tokens.Pos}
-		}
-		return sub
-	}
-	return parser.ResultFail("No trailer.",tokens.SafePos())
-}
-
-func c_expr5(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	return p.Match("Expr4",tokens)
-}
-func c_expr_trailer5(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	var ok bool
-	var t  *scanlist.Element
-	ok = false
-	s := ""
-	if !ok { ok,t = parser.FastMatch(tokens,'>','>'); if ok { s=">>" } }
-	if !ok { ok,t = parser.FastMatch(tokens,'<','<'); if ok { s="<<" } }
-	if !ok { ok,t = parser.FastMatch(tokens,'^') }
-	if !ok { ok,t = parser.FastMatch(tokens,'|') }
-	if !ok { ok,t = parser.FastMatch(tokens,'&') }
-	
-	if ok {
-		if s=="" { s = tokens.TokenText }
-		op := E_BINARY_OP
-		if t.SafeToken()=='=' {
-			op = E_BINARY_OP_ASSIGN
-			t = t.SafeNext()
-		}
-		sub := p.MatchNoLeftRecursion("Expr5",t)
-		if sub.Result==parser.RESULT_OK {
-			sub.Data = &Expr{op,s,aR(left,sub.Data),tokens.Pos}
-		}
-		return sub
-	}
-	return parser.ResultFail("No trailer.",tokens.SafePos())
-}
-func c_expr6(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	return p.Match("Expr5",tokens)
-}
-func c_expr_trailer6(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	s := ""
-	ok,t := parser.FastMatch(tokens,'=','='); if ok { s="==" }
-	if !ok { ok,t = parser.FastMatch(tokens,'!','='); if ok { s="!=" } }
-	if !ok { ok,t = parser.FastMatch(tokens,'<','='); if ok { s="<=" } }
-	if !ok { ok,t = parser.FastMatch(tokens,'<'); if ok { s="<" } }
-	if !ok { ok,t = parser.FastMatch(tokens,'>','='); if ok { s=">=" } }
-	if !ok { ok,t = parser.FastMatch(tokens,'>'); if ok { s=">" } }
-	if ok {
-		sub := p.MatchNoLeftRecursion("Expr6",t)
-		if sub.Result==parser.RESULT_OK {
-			sub.Data = &Expr{E_COMPARE,s,aR(left,sub.Data),tokens.Pos}
-		}
-		return sub
-	}
-	return parser.ResultFail("No trailer.",tokens.SafePos())
-}
-
-func c_expr7(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	return p.Match("Expr6",tokens)
-}
-func c_expr_trailer7(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	var t *scanlist.Element
-	ok := false
-	s := ""
-	if !ok { ok,t = parser.FastMatch(tokens,'&','&'); if ok { s="&&" } }
-	if !ok { ok,t = parser.FastMatch(tokens,'|','|'); if ok { s="||" } }
-	
-	if ok {
-		if s=="" { s = tokens.TokenText }
-		op := E_BINARY_OP
-		if t.SafeToken()=='=' {
-			op = E_BINARY_OP_ASSIGN
-			t = t.SafeNext()
-		}
-		sub := p.MatchNoLeftRecursion("Expr7",t)
-		if sub.Result==parser.RESULT_OK {
-			sub.Data = &Expr{op,s,aR(left,sub.Data),tokens.Pos}
-		}
-		return sub
-	}
-	return parser.ResultFail("No trailer.",tokens.SafePos())
-}
-
-func c_expr8(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	return p.Match("Expr7",tokens)
-}
 func c_expr_trailer8(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
 	if tokens.SafeToken()=='?' {
-		sub := p.Match("Expr7",tokens.Next())
+		sub := p.Match("ExprOp",tokens.Next())
 		if sub.Result!=parser.RESULT_OK { return sub }
 		e,t := parser.Match(parser.Textify,sub.Next,':')
 		if e!=nil { return parser.ResultFail(fmt.Sprint(e),sub.Next.SafePos()) }
-		sub2 := p.MatchNoLeftRecursion("Expr7",t)
+		sub2 := p.MatchNoLeftRecursion("ExprOp",t)
 		if sub2.Result!=parser.RESULT_OK { return sub2 }
 		return parser.ResultOk(sub2.Next,&Expr{E_CONDITIONAL,"?:",aR(left,sub.Data,sub2.Data),tokens.Pos})
 	}
 	return parser.ResultFail("No trailer.",tokens.SafePos())
 }
 
-func c_expr(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
-	return p.Match("Expr8",tokens)
-}
 func c_expr_trailer(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
 	ok,t := parser.FastMatch(tokens,'=')
 	
@@ -369,30 +255,33 @@ The following expression classes are registered.
 	'Expr5' // Bitwise expression
 	'Expr6' // Relational expression
 	'Expr7' // Logical expression
+	'ExprOp' // All binary operators
 	'Expr8' // Conditional expression
 	'Expr'  // Expression
+The binary operators are parsed by precedence climbing over the operator table
+(see Operators()), so 'Expr4' consists of the operators, that bind at least as
+tight as '+', including user-declared ones.
 */
 func RegisterExpr(p *parser.Parser) {
-	p.Define("Expr0",false,parser.Pfunc(c_expr0))
-	p.Define("Expr0",true,parser.Pfunc(c_expr_trailer0))
+	expr0 := c_expr_unary_cases("Expr0")
+	expr0['('/*)*/] = parser.Action{parser.LSeq{parser.Required{'('/*)*/,parser.Textify},parser.Delegate("Expr")},c_expr_paren}
+	p.Define("Expr0",false,parser.Switch{expr0,
+		parser.Pfunc(c_expr0).First(scanner.Ident,scanner.Int,scanner.Float,scanner.Char,scanner.String,scanner.RawString)})
+	p.Define("Expr0",true,parser.Pfunc(c_expr_trailer0).First(C_INC,C_DEC,C_ARROW,'.','('/*)*/,'['/*]*/))
 	
-	p.Define("Expr1",false,parser.Pfunc(c_expr1))
-	p.Define("Expr2",false,parser.Pfunc(c_expr2))
-	p.Define("Expr3",false,parser.Pfunc(c_expr3))
-	p.Define("Expr3",true,parser.Pfunc(c_expr_trailer3))
-	p.Define("Expr4",false,parser.Pfunc(c_expr4))
-	p.Define("Expr4",true,parser.Pfunc(c_expr_trailer4))
-	p.Define("Expr5",false,parser.Pfunc(c_expr5))
-	p.Define("Expr5",true,parser.Pfunc(c_expr_trailer5))
-	p.Define("Expr6",false,parser.Pfunc(c_expr6))
-	p.Define("Expr6",true,parser.Pfunc(c_expr_trailer6))
-	p.Define("Expr7",false,parser.Pfunc(c_expr7))
-	p.Define("Expr7",true,parser.Pfunc(c_expr_trailer7))
-	p.Define("Expr8",false,parser.Pfunc(c_expr8))
-	p.Define("Expr8",true,parser.Pfunc(c_expr_trailer8))
+	p.Define("Expr1",false,parser.Switch{c_expr_unary_cases("Expr1"),parser.Delegate("Expr0")})
+	p.Define("Expr2",false,parser.Delegate("Expr1"))
+	p.Define("Expr3",false,c_expr_level(c_op3))
+	p.Define("Expr4",false,c_expr_level(c_op4))
+	p.Define("Expr5",false,c_expr_level(c_op5))
+	p.Define("Expr6",false,c_expr_level(c_op6))
+	p.Define("Expr7",false,c_expr_level(c_op7))
+	p.Define("ExprOp",false,c_expr_level(c_op_all))
+	p.Define("Expr8",false,parser.Delegate("ExprOp"))
+	p.Define("Expr8",true,parser.Pfunc(c_expr_trailer8).First('?'))
 	
-	p.Define("Expr",false,parser.Pfunc(c_expr))
-	p.Define("Expr",true,parser.Pfunc(c_expr_trailer))
+	p.Define("Expr",false,parser.Delegate("Expr8"))
+	p.Define("Expr",true,parser.Pfunc(c_expr_trailer).First('='))
 }
 
 /*
@@ -401,6 +290,6 @@ Adds the casting operation (Type)Expr.
 */
 func RegisterExprCast(p *parser.Parser) {
 	p.TouchRule("Type")
-	p.DefineBefore("Expr2",false,parser.Pfunc(c_expr_cast))
+	p.DefineBefore("Expr2",false,parser.Pfunc(c_expr_cast).First('('/*)*/))
 }
 
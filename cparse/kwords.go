@@ -28,6 +28,7 @@ A set of parser rules for C-Like syntax.
 package cparse
 
 import "github.com/byte-mug/semiparse/scanlist"
+import "io"
 
 const (
 	C_IF = rune(-(100+iota))
@@ -47,3 +48,69 @@ var CKeywords = scanlist.TokenDict{
 	"const":C_CONST,
 }
 
+// Multi-character operators.
+const (
+	C_EQ = rune(-(200+iota))
+	C_NE
+	C_LE
+	C_GE
+	C_SHL
+	C_SHR
+	C_AND
+	C_OR
+	C_INC
+	C_DEC
+	C_ARROW
+	C_ADD_ASSIGN
+	C_SUB_ASSIGN
+	C_MUL_ASSIGN
+	C_DIV_ASSIGN
+	C_MOD_ASSIGN
+	C_SHL_ASSIGN
+	C_SHR_ASSIGN
+	C_AND_ASSIGN
+	C_OR_ASSIGN
+	C_XOR_ASSIGN
+)
+
+/*
+The multi-character operators, to be used as scanlist.BaseScanner.Ops. The
+expression rules expect these tokens, so "a > > b" is no shift and "a + = b"
+no assignment. See NewScanner().
+*/
+var COperators = scanlist.TokenDict{
+	"==":C_EQ,
+	"!=":C_NE,
+	"<=":C_LE,
+	">=":C_GE,
+	"<<":C_SHL,
+	">>":C_SHR,
+	"&&":C_AND,
+	"||":C_OR,
+	"++":C_INC,
+	"--":C_DEC,
+	"->":C_ARROW,
+	"+=":C_ADD_ASSIGN,
+	"-=":C_SUB_ASSIGN,
+	"*=":C_MUL_ASSIGN,
+	"/=":C_DIV_ASSIGN,
+	"%=":C_MOD_ASSIGN,
+	"<<=":C_SHL_ASSIGN,
+	">>=":C_SHR_ASSIGN,
+	"&=":C_AND_ASSIGN,
+	"|=":C_OR_ASSIGN,
+	"^=":C_XOR_ASSIGN,
+}
+
+/*
+Returns a BaseScanner for src with CKeywords and COperators, as expected by
+the rules of this package.
+*/
+func NewScanner(src io.Reader) *scanlist.BaseScanner {
+	s := new(scanlist.BaseScanner)
+	s.Init(src)
+	s.Dict = CKeywords
+	s.Ops = COperators
+	return s
+}
+
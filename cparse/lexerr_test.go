@@ -0,0 +1,47 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "strings"
+import "testing"
+
+func TestLexicalError(t *testing.T) {
+	for _,iter := range []bool{false,true} {
+		p := newParser()
+		p.Iterative = iter
+		for _,c := range []struct{ src,want string }{
+			{"x = \"abc;","literal not terminated"},
+			{"x = 'ab';","invalid char literal"},
+			{"x = a + \"abc;","literal not terminated"},
+			{"if(\"a) x = 1;","literal not terminated"},
+		}{
+			res := p.Match("Statement",lex(c.src))
+			msg,_ := res.Data.(string)
+			if res.Ok() || !strings.HasPrefix(msg,"Lexical error: ") || !strings.Contains(msg,c.want) {
+				t.Errorf("iterative=%v %q: %v",iter,c.src,res.Data)
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "text/scanner"
+import "sort"
+import "math"
+import "fmt"
+
+const (
+	ASSOC_LEFT = uint(iota)
+	ASSOC_RIGHT
+	ASSOC_NONE
+)
+
+// Precedences of the built-in binary operators.
+const (
+	PREC_LOGICAL = 3+iota // && ||
+	PREC_COMPARE // == != <= < >= >
+	PREC_BITWISE // << >> ^ | &
+	PREC_ADD // + -
+	PREC_MUL // * / %
+)
+
+// An infix operator.
+type Operator struct{
+	Text string
+	Prec int // higher binds tighter
+	Assoc uint
+	
+	tok rune // built-in operators match this token
+	typ uint
+	assign rune // the token of the compound assignment, like C_ADD_ASSIGN
+}
+
+// Reports, whether op is a built-in operator.
+func (op *Operator) Builtin() bool { return op.tok!=0 }
+
+var c_builtins = []struct{
+	text string
+	tok,assign rune
+	prec int
+	typ uint
+}{
+	{"*",'*',C_MUL_ASSIGN,PREC_MUL,E_BINARY_OP},
+	{"/",'/',C_DIV_ASSIGN,PREC_MUL,E_BINARY_OP},
+	{"%",'%',C_MOD_ASSIGN,PREC_MUL,E_BINARY_OP},
+	{"+",'+',C_ADD_ASSIGN,PREC_ADD,E_BINARY_OP},
+	{"-",'-',C_SUB_ASSIGN,PREC_ADD,E_BINARY_OP},
+	{">>",C_SHR,C_SHR_ASSIGN,PREC_BITWISE,E_BINARY_OP},
+	{"<<",C_SHL,C_SHL_ASSIGN,PREC_BITWISE,E_BINARY_OP},
+	{"^",'^',C_XOR_ASSIGN,PREC_BITWISE,E_BINARY_OP},
+	{"|",'|',C_OR_ASSIGN,PREC_BITWISE,E_BINARY_OP},
+	{"&",'&',C_AND_ASSIGN,PREC_BITWISE,E_BINARY_OP},
+	{"==",C_EQ,0,PREC_COMPARE,E_COMPARE},
+	{"!=",C_NE,0,PREC_COMPARE,E_COMPARE},
+	{"<=",C_LE,0,PREC_COMPARE,E_COMPARE},
+	{"<",'<',0,PREC_COMPARE,E_COMPARE},
+	{">=",C_GE,0,PREC_COMPARE,E_COMPARE},
+	{">",'>',0,PREC_COMPARE,E_COMPARE},
+	{"&&",C_AND,0,PREC_LOGICAL,E_BINARY_OP},
+	{"||",C_OR,0,PREC_LOGICAL,E_BINARY_OP},
+}
+
+func c_builtin_ops() []*Operator {
+	ops := []*Operator{}
+	for _,b := range c_builtins { ops = append(ops,&Operator{b.text,b.prec,ASSOC_LEFT,b.tok,b.typ,b.assign}) }
+	sort.SliceStable(ops,func(i,j int) bool { return len(ops[i].Text)>len(ops[j].Text) })
+	return ops
+}
+
+/*
+A table of infix operators. It contains the built-in binary operators and the
+user-declared ones. All of them bind tighter than '?:' and '='.
+*/
+type OperatorTable struct{
+	ops []*Operator // longest first
+}
+
+// Returns a new table, containing the built-in binary operators only.
+func NewOperatorTable() *OperatorTable { return &OperatorTable{c_builtin_ops()} }
+
+// Used, if the parse state has no table.
+var c_default_ops = NewOperatorTable()
+
+type operatorsKey struct{}
+
+/*
+Returns the operator table of p's parse state, creating it, if neccessary.
+ParseDeclarations() parses each file with a copy of this table, so operators,
+declared in a file, don't leak into the next one.
+*/
+func Operators(p *parser.Parser) *OperatorTable {
+	if t,ok := p.State(operatorsKey{}).(*OperatorTable); ok { return t }
+	t := NewOperatorTable()
+	p.SetState(operatorsKey{},t)
+	return t
+}
+
+func c_operators(p *parser.Parser) *OperatorTable {
+	if t,ok := p.State(operatorsKey{}).(*OperatorTable); ok { return t }
+	return c_default_ops
+}
+
+/*
+Gives p a copy of its operator table and returns a function, that restores the
+original one.
+*/
+func c_scope_operators(p *parser.Parser) func() {
+	old := p.State(operatorsKey{})
+	if t,ok := old.(*OperatorTable); ok { p.SetState(operatorsKey{},t.copy()) }
+	return func() { p.SetState(operatorsKey{},old) }
+}
+
+func (t *OperatorTable) copy() *OperatorTable {
+	c := new(OperatorTable)
+	for _,op := range t.ops { o := *op; c.ops = append(c.ops,&o) }
+	return c
+}
+
+// Implements parser.StateForker, so forks of a Parser don't share the table.
+func (t *OperatorTable) ForkState() interface{} { return t.copy() }
+
+/*
+Declares (or redeclares) an operator. Redeclaring a built-in operator changes
+its precedence and associativity.
+*/
+func (t *OperatorTable) Declare(text string, prec int, assoc uint) {
+	for _,op := range t.ops {
+		if op.Text==text { op.Prec,op.Assoc = prec,assoc; return }
+	}
+	t.ops = append(t.ops,&Operator{Text:text,Prec:prec,Assoc:assoc,typ:E_BINARY_OP})
+	sort.SliceStable(t.ops,func(i,j int) bool { return len(t.ops[i].Text)>len(t.ops[j].Text) })
+}
+
+// Returns the operators, longest first.
+func (t *OperatorTable) Operators() []*Operator { return t.ops }
+
+/*
+Matches the longest operator at tokens. Built-in operators are matched by
+their token. User-declared operators are matched against the text of adjacent
+tokens, so "<+>" matches the tokens '<' '+' '>', but not '<' '+' ' ' '>'.
+*/
+func (t *OperatorTable) Match(tokens *scanlist.Element) (*Operator,*scanlist.Element) {
+	if t==nil || tokens==nil { return nil,nil }
+	for _,op := range t.ops {
+		if op.tok!=0 {
+			if tokens.Token==op.tok { return op,tokens.Next() }
+			continue
+		}
+		s := ""
+		cur := tokens
+		end := -1
+		for cur!=nil && len(s)<len(op.Text) {
+			if end>=0 && cur.Start.Offset!=end { break }
+			s += cur.TokenText
+			end = scanlist.EndOffset(cur)
+			cur = cur.Next()
+		}
+		if s==op.Text { return op,cur }
+	}
+	return nil,nil
+}
+
+// Like Match, but also matches compound assignments (E_BINARY_OP_ASSIGN), like "+=".
+func (t *OperatorTable) matchOp(tokens *scanlist.Element) (*Operator,uint,*scanlist.Element) {
+	op,n := t.Match(tokens)
+	if op!=nil { return op,op.typ,n }
+	if tokens==nil { return nil,0,nil }
+	for _,op := range t.ops {
+		if op.assign!=0 && tokens.Token==op.assign { return op,E_BINARY_OP_ASSIGN,tokens.Next() }
+	}
+	return nil,0,nil
+}
+
+// Reports, whether a user-declared operator starts at tokens.
+func c_user_op(p *parser.Parser,tokens *scanlist.Element) bool {
+	op,_ := c_operators(p).Match(tokens)
+	return op!=nil && !op.Builtin()
+}
+
+// An operator between two operands.
+type c_op_item struct{
+	op *Operator
+	typ uint
+	pos scanner.Position
+}
+
+// Matches an operator of at least precedence min.
+func c_op_level(p *parser.Parser,tokens *scanlist.Element, min int) parser.ParserResult {
+	op,typ,n := c_operators(p).matchOp(tokens)
+	if op==nil || op.Prec<min { return parser.ResultFail("No operator.",tokens.SafePos()) }
+	return parser.ResultOk(n,c_op_item{op,typ,tokens.Pos})
+}
+
+func c_op3(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	return c_op_level(p,tokens,PREC_MUL)
+}
+func c_op4(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	return c_op_level(p,tokens,PREC_ADD)
+}
+func c_op5(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	return c_op_level(p,tokens,PREC_BITWISE)
+}
+func c_op6(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	return c_op_level(p,tokens,PREC_COMPARE)
+}
+func c_op7(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	return c_op_level(p,tokens,PREC_LOGICAL)
+}
+func c_op_all(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	return c_op_level(p,tokens,math.MinInt)
+}
+
+/*
+Expr2 [ Op Expr2 ]*. The operands and operators are collected by combinators
+(so deep nesting doesn't recurse in the iterative engine) and grouped by
+c_expr_climb afterwards. Like the left recursion of a rule, it stops before an
+operator, whose right operand fails to parse.
+*/
+func c_expr_level(op parser.Pfunc) parser.ParseRule {
+	return parser.Action{parser.ArraySeq{
+		parser.Delegate("Expr2"),
+		parser.ArrayStar{parser.ArraySeq{op,parser.Delegate("Expr2")}},
+	},c_expr_climb}
+}
+
+func c_expr_climb(res parser.ParserResult,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	if !res.Ok() { return res }
+	i := res.Data.([]interface{})
+	c := &c_climber{operands:[]interface{}{i[0]}}
+	for _,x := range i[1].([]interface{}) {
+		x := x.([]interface{})
+		c.ops = append(c.ops,x[0].(c_op_item))
+		c.operands = append(c.operands,x[1])
+	}
+	e,err := c.climb(math.MinInt)
+	if err!=nil { return parser.ResultFail(err.Error(),c.errPos) }
+	res.Data = e
+	return res
+}
+
+// Precedence climbing over operands[k:] and ops[k:].
+type c_climber struct{
+	operands []interface{}
+	ops []c_op_item
+	k int
+	errPos scanner.Position
+}
+
+func (c *c_climber) climb(min int) (interface{},error) {
+	lhs := c.operands[c.k]
+	for c.k<len(c.ops) && c.ops[c.k].op.Prec>=min {
+		op := c.ops[c.k]
+		c.k++
+		rhs := c.operands[c.k]
+		for c.k<len(c.ops) {
+			nop := c.ops[c.k].op
+			if nop.Prec==op.op.Prec && op.op.Assoc==ASSOC_NONE {
+				c.errPos = c.ops[c.k].pos
+				return nil,fmt.Errorf("Operator %s is not associative",op.op.Text)
+			}
+			var err error
+			if nop.Prec>op.op.Prec {
+				rhs,err = c.climb(op.op.Prec+1)
+			} else if nop.Prec==op.op.Prec && nop.Assoc==ASSOC_RIGHT {
+				rhs,err = c.climb(op.op.Prec)
+			} else {
+				break
+			}
+			if err!=nil { return nil,err }
+		}
+		lhs = &Expr{op.typ,op.op.Text,aR(lhs,rhs),op.pos}
+	}
+	return lhs,nil
+}
@@ -0,0 +1,117 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "runtime/debug"
+import "strings"
+import "sync"
+import "fmt"
+import "testing"
+
+func newParser() *parser.Parser {
+	p := new(parser.Parser).Construct()
+	RegisterExpr(p)
+	RegisterType(p)
+	RegisterExprCast(p)
+	RegisterStatememt(p)
+	RegisterDeclaration(p)
+	return p
+}
+
+func lex(src string) *scanlist.Element { return NewScanner(strings.NewReader(src)).Next() }
+
+func TestOperatorPrecedence(t *testing.T) {
+	p := newParser()
+	Operators(p).Declare("<+>",PREC_ADD,ASSOC_LEFT)
+	Operators(p).Declare("<*>",PREC_MUL+1,ASSOC_RIGHT)
+	Operators(p).Declare("<~>",PREC_COMPARE,ASSOC_NONE)
+	for _,c := range []struct{ src,want string }{
+		{"a <+> b * c + d","((a<+>(b*c))+d)"},
+		{"a + b <+> c","((a+b)<+>c)"},
+		{"a * b <*> c <*> d","(a*(b<*>(c<*>d)))"},
+		{"a <~> b && c","((a<~>b)&&c)"},
+		{"a & b + c ? d : e","((a&(b+c))?d:e)"},
+		{"a += b","(a+=b)"},
+		{"a <<= b * c","(a<<=(b*c))"},
+	}{
+		res := p.Match("Expr",lex(c.src))
+		if !res.Ok() || res.Next!=nil { t.Errorf("%q: %v %v",c.src,res.Data,res.Next.SafeTokenText()); continue }
+		if got := fmt.Sprint(res.Data); got!=c.want { t.Errorf("%q: got %s, want %s",c.src,got,c.want) }
+	}
+	if res := p.Match("Expr",lex("a <~> b <~> c")); res.Ok() { t.Errorf("non-associative operator chained: %v",res.Data) }
+	for _,src := range []string{"a + = b","a < < = b","a && = b"} {
+		if res := p.Match("Expr",lex(src)); res.Ok() && res.Next==nil { t.Errorf("%q: parsed as %v",src,res.Data) }
+	}
+}
+
+func TestOperatorScope(t *testing.T) {
+	p := newParser()
+	Operators(p).Declare("<*>",PREC_MUL,ASSOC_LEFT)
+	res := ParseDeclarations(p,lex(`#infixl 6 "<+>" int f(int a) { x = a <+> b <*> c; }`))
+	if !res.Ok() { t.Fatalf("%v at %v",res.Data,res.Pos) }
+	
+	// The directive doesn't outlive the file, but the operator, declared from Go, does.
+	if res := ParseDeclarations(p,lex(`int g(int a) { x = a <+> b; }`)); res.Ok() { t.Errorf("<+> is still declared") }
+	if res := ParseDeclarations(p,lex(`int g(int a) { x = a <*> b; }`)); !res.Ok() { t.Errorf("<*>: %v",res.Data) }
+}
+
+// Forks don't share the operator table, so they can declare operators concurrently.
+func TestOperatorFork(t *testing.T) {
+	p := newParser()
+	Operators(p).Declare("<*>",PREC_MUL,ASSOC_LEFT)
+	p.Freeze()
+	var wg sync.WaitGroup
+	for i := 0; i<4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			q := p.Fork()
+			op := fmt.Sprintf("<%d>",i)
+			if r := q.Match("Declaration",lex(fmt.Sprintf(`#infixl 6 %q`,op))); !r.Ok() { t.Errorf("%s: %v",op,r.Data); return }
+			if r := q.Match("Expr",lex("a "+op+" b <*> c")); !r.Ok() || r.Next!=nil { t.Errorf("%s: %v",op,r.Data) }
+		}(i)
+	}
+	wg.Wait()
+	if len(Operators(p).Operators())!=len(NewOperatorTable().Operators())+1 { t.Errorf("the forks declared operators in p") }
+}
+
+// The operator levels must not recurse in the iterative engine.
+func TestDeepNesting(t *testing.T) {
+	defer debug.SetMaxStack(debug.SetMaxStack(16<<20))
+	n := 30000
+	p := newParser()
+	p.Iterative = true
+	res := p.Match("Expr",lex(strings.Repeat("(-",n)+"x"+strings.Repeat(")",n)))
+	if !res.Ok() || res.Next!=nil { t.Fatal(res.Data) }
+}
+
+func TestStatementOperators(t *testing.T) {
+	p := newParser()
+	for _,src := range []string{"{ if (a==b) { x += 1; } }","{ p->n >>= 2; i++; }"} {
+		if res := p.Match("Statement",lex(src)); !res.Ok() || res.Next!=nil { t.Errorf("%q: %v",src,res.Data) }
+	}
+}
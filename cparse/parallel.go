@@ -0,0 +1,129 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "runtime"
+import "sync"
+
+/*
+Parses 'Declaration's up to the end of tokens. On success, the Data of the
+result is a []interface{} of the declarations. Operators, declared in tokens,
+are forgotten afterwards.
+*/
+func ParseDeclarations(p *parser.Parser,tokens *scanlist.Element) parser.ParserResult {
+	defer c_scope_operators(p)()
+	decls := []interface{}{}
+	for tokens!=nil {
+		r := p.Match("Declaration",tokens)
+		if !r.Ok() { return r }
+		decls = append(decls,r.Data)
+		tokens = r.Next
+	}
+	return parser.ResultOk(nil,decls)
+}
+
+/*
+Splits tokens into top-level chunks, each ending with a '}' or ';' outside
+of any brackets. Fully materializes the token list.
+*/
+func c_chunks(tokens *scanlist.Element) (chunks []*scanlist.Element,ok bool) {
+	depth := 0
+	start := true
+	ok = true
+	for t := tokens; t!=nil; t = t.Next() {
+		if start { chunks = append(chunks,t); start = false }
+		switch t.Token {
+		case '(','[','{': depth++
+		case ')',']': depth--
+		case '}':
+			depth--
+			if depth==0 { start = true }
+		case ';':
+			if depth==0 { start = true }
+		case '#':
+			// Operator declarations affect the subsequent chunks.
+			switch t.Next().SafeTokenText() {
+			case "infix","infixl","infixr": ok = false
+			}
+		}
+	}
+	return
+}
+
+/*
+Like ParseDeclarations(), but parses the top-level chunks (see above) of the
+input concurrently, using up to workers goroutines (or GOMAXPROCS, if
+workers<=0). The grammar of p must be frozen. The declarations are returned in
+source order. If a chunk boundary turns out to be wrong (a chunk doesn't parse
+into a whole number of declarations), or if the input declares operators, it
+falls back to ParseDeclarations(), so the result is always the same.
+*/
+func ParseDeclarationsParallel(p *parser.Parser,tokens *scanlist.Element,workers int) parser.ParserResult {
+	if !p.Frozen() { panic("grammar not frozen") }
+	chunks,ok := c_chunks(tokens)
+	if !ok || len(chunks)<2 { return ParseDeclarations(p,tokens) }
+	if workers<=0 { workers = runtime.GOMAXPROCS(0) }
+	// The index of each token, to tell, whether a declaration ends past its chunk.
+	index := make(map[*scanlist.Element]int)
+	n := 0
+	for t := tokens; t!=nil; t = t.Next() { index[t] = n; n++ }
+	index[nil] = n
+	
+	results := make([][]interface{},len(chunks))
+	failed := make([]bool,len(chunks))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w<workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q := p.Fork()
+			for i := range next {
+				var end *scanlist.Element
+				if i+1<len(chunks) { end = chunks[i+1] }
+				// A declaration, that ends past the end of its chunk, is parsed by
+				// the next chunk(s) as well, so the boundary is wrong.
+				for t,lim := chunks[i],index[end]; t!=end; {
+					r := q.Match("Declaration",t)
+					if !r.Ok() || index[r.Next]>lim { failed[i] = true; break }
+					results[i] = append(results[i],r.Data)
+					t = r.Next
+				}
+			}
+		}()
+	}
+	for i := range chunks { next <- i }
+	close(next)
+	wg.Wait()
+	
+	decls := []interface{}{}
+	for i := range chunks {
+		if failed[i] { return ParseDeclarations(p,tokens) }
+		decls = append(decls,results[i]...)
+	}
+	return parser.ResultOk(nil,decls)
+}
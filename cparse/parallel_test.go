@@ -0,0 +1,87 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cparse
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "text/scanner"
+import "reflect"
+import "sync/atomic"
+import "testing"
+
+func checkParallel(t *testing.T,p *parser.Parser,src string) {
+	want := ParseDeclarations(p,lex(src))
+	for _,w := range []int{0,1,3} {
+		got := ParseDeclarationsParallel(p,lex(src),w)
+		if got.Result!=want.Result || got.Pos!=want.Pos || !reflect.DeepEqual(got.Data,want.Data) {
+			t.Errorf("%q, %d workers: got %v, want %v",src,w,got,want)
+		}
+	}
+}
+
+// The parallel parse gives the same result as the sequential one.
+func TestParseDeclarationsParallel(t *testing.T) {
+	p := newParser()
+	p.Freeze()
+	for _,c := range []struct{
+		src string
+		chunks int
+		ok bool
+	}{
+		{`int f(int a); int g(int a) { a = a*2; } char h(char c); #cinclude "a.h" int k(int x) { if (x) { x--; } }`,4,true},
+		{`int f(int a); #infixl 6 "<+>" int g(int x) { x = x <+> x; } int h(int b);`,3,false},
+		{"int f(int a); int g(int x) { x = ; } int h(int b);",3,true},
+		{"int f(int a); int g(int b) }",2,true},
+		{"int f(int a); int g(int b)",2,true},
+		{"int f(int a);",1,true},
+		{"",0,true},
+	}{
+		chunks,ok := c_chunks(lex(c.src))
+		if len(chunks)!=c.chunks || ok!=c.ok { t.Errorf("%q: %d chunks, ok=%v",c.src,len(chunks),ok) }
+		checkParallel(t,p,c.src)
+	}
+}
+
+// Declarations, that span several chunks, are parsed sequentially, without parsing past their chunks first.
+func TestParseDeclarationsParallelSpan(t *testing.T) {
+	var calls int32
+	p := new(parser.Parser).Construct()
+	p.Define("Declaration",false,parser.Pfunc(func(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+		atomic.AddInt32(&calls,1)
+		return parser.ArraySeq{parser.Required{scanner.Ident,nil},parser.Required{';',nil},parser.Required{scanner.Ident,nil}}.Parse(p,tokens,left)
+	}))
+	p.Freeze()
+	checkParallel(t,p,"a; b c; d")
+	
+	src := "a; b c; d e; f"
+	calls = 0
+	want := ParseDeclarations(p,lex(src))
+	seq := calls
+	chunks,_ := c_chunks(lex(src))
+	calls = 0
+	got := ParseDeclarationsParallel(p,lex(src),1)
+	if !got.Ok() || !reflect.DeepEqual(got.Data,want.Data) { t.Fatalf("got %v, want %v",got,want) }
+	if calls>seq+int32(len(chunks)) { t.Errorf("%d calls, %d sequential calls and %d chunks",calls,seq,len(chunks)) }
+}
@@ -47,6 +47,12 @@ type VarDecl struct{
 	Name string
 	Init interface{} // Expr
 }
+// Implements parser.PosShifter, so parser.Document can reuse it.
+func (v VarDecl) ShiftPos(s parser.PosShift) (interface{},bool) {
+	i,ok := s.Data(v.Init)
+	v.Init = i
+	return v,ok
+}
 func (v VarDecl) String() string {
 	if v.Init!=nil { return fmt.Sprint(v.Name," = ",v.Init) }
 	return v.Name
@@ -58,6 +64,13 @@ type Statement struct{
 	Data []interface{}
 	Pos scanner.Position
 }
+// Implements parser.PosShifter, so parser.Document can reuse it.
+func (e *Statement) ShiftPos(s parser.PosShift) (interface{},bool) {
+	if e==nil { return e,true }
+	d,ok := c_shift(s,e.Data)
+	if !ok { return nil,false }
+	return &Statement{e.Type,e.Text,d,s.Pos(e.Pos)},true
+}
 func (e *Statement) String() string {
 	if e==nil { return "NIL" }
 	switch e.Type {
@@ -137,15 +150,6 @@ func c_statement_vardecl(p *parser.Parser,tokens *scanlist.Element, left interfa
 func c_statement(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
 	if tokens==nil { return parser.ResultFail("EOF!",scanner.Position{}) }
 	switch tokens.Token {
-	case '{' /*}*/:
-		res := parser.ArrayStar{parser.Delegate("Statement")}.Parse(p,tokens.Next(),left)
-		if res.Result==parser.RESULT_OK {
-			err,t := parser.Match(parser.Textify,res.Next,/*{*/'}')
-			if err!=nil { return parser.ResultFail(fmt.Sprint(err),tokens.SafePos()) }
-			res.Next = t
-			res.Data = &Statement{S_BLOCK,"{}",res.Data.([]interface{}),tokens.Pos}
-		}
-		return res
 	case C_FOR:
 		ars := parser.ArraySeq{
 			parser.LSeq{parser.Required{'('/*)*/,parser.Textify},
@@ -207,8 +211,22 @@ func c_statement(p *parser.Parser,tokens *scanlist.Element, left interface{}) pa
 	
 	return parser.ResultFail("Invalid Statement!",tokens.SafePos())
 }
+
+// '{' Statement* '}' => S_BLOCK
+func c_statement_block(res parser.ParserResult,tokens *scanlist.Element, left interface{}) parser.ParserResult {
+	if res.Result==parser.RESULT_OK {
+		err,t := parser.Match(parser.Textify,res.Next,/*{*/'}')
+		if err!=nil { return parser.ResultFail(fmt.Sprint(err),tokens.SafePos()) }
+		res.Next = t
+		res.Data = &Statement{S_BLOCK,"{}",res.Data.([]interface{}),tokens.Pos}
+	}
+	return res
+}
+
 func RegisterStatememt(p *parser.Parser) {
 	p.Define("StatementPrim",false,parser.Pfunc(c_statement_prim))
-	p.Define("Statement",false,parser.Pfunc(c_statement))
+	p.Define("Statement",false,parser.Switch{map[rune]parser.ParseRule{
+		'{'/*}*/: parser.Action{parser.LSeq{parser.Required{'{'/*}*/,parser.Textify},parser.ArrayStar{parser.Delegate("Statement")}},c_statement_block},
+	},parser.Pfunc(c_statement)})
 }
 
@@ -44,6 +44,13 @@ type DType struct{
 	Data []interface{}
 	Pos scanner.Position
 }
+// Implements parser.PosShifter, so parser.Document can reuse it.
+func (d *DType) ShiftPos(s parser.PosShift) (interface{},bool) {
+	if d==nil { return d,true }
+	c,ok := c_shift(s,d.Data)
+	if !ok { return nil,false }
+	return &DType{d.Type,d.Text,c,s.Pos(d.Pos)},true
+}
 func (d *DType) String() string {
 	if d==nil { return "NIL" }
 	switch d.Type {
@@ -74,7 +81,7 @@ func c_type(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.
 		}
 		return sub
 	}
-	return parser.ResultFail("Invalid Type!",tokens.Pos)
+	return parser.ResultFail("Invalid Type!",tokens.SafePos())
 }
 
 func c_type_trailer(p *parser.Parser,tokens *scanlist.Element, left interface{}) parser.ParserResult {
@@ -84,11 +91,11 @@ func c_type_trailer(p *parser.Parser,tokens *scanlist.Element, left interface{})
 	case '*':
 		return parser.ResultOk(tokens.Next(),&DType{T_PTR,tokens.TokenText,aR(left),tokens.Pos})
 	}
-	return parser.ResultFail("Invalid Type!",tokens.Pos)
+	return parser.ResultFail("Invalid Type!",tokens.SafePos())
 }
 
 func RegisterType(p *parser.Parser) {
-	p.Define("Type",false,parser.Pfunc(c_type))
-	p.Define("Type",true,parser.Pfunc(c_type_trailer))
+	p.Define("Type",false,parser.Pfunc(c_type).First(scanner.Ident,C_CONST))
+	p.Define("Type",true,parser.Pfunc(c_type_trailer).First(C_CONST,'*'))
 }
 
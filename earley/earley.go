@@ -0,0 +1,216 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package earley
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "text/scanner"
+import "fmt"
+
+type item struct{
+	prod *Production
+	dot int
+	origin int
+}
+func (it item) next() *Symbol {
+	if it.dot<len(it.prod.RHS) { return it.prod.RHS[it.dot] }
+	return nil
+}
+
+type set struct{
+	items []item
+	has map[item]bool
+}
+func (s *set) add(it item) {
+	if s.has[it] { return }
+	s.has[it] = true
+	s.items = append(s.items,it)
+}
+
+// A syntax error: no parse exists.
+type Error struct{
+	Pos scanner.Position
+	Token *scanlist.Element // nil at the end of the input
+}
+func (e *Error) Error() string {
+	return fmt.Sprint(e.Pos,": unexpected ",textify(e.Token))
+}
+
+/*
+Parses all of tokens and returns the root of the parse forest, or an *Error,
+if no parse exists.
+*/
+func (g *Grammar) Parse(tokens *scanlist.Element) (*Node,error) {
+	var toks []*scanlist.Element
+	for t := tokens; t!=nil; t = t.Next() { toks = append(toks,t) }
+	
+	sets := make([]*set,len(toks)+1)
+	for i := range sets { sets[i] = &set{has:make(map[item]bool)} }
+	for _,pr := range g.Start.prods { sets[0].add(item{pr,0,0}) }
+	
+	last := 0
+	for k,s := range sets {
+		for i := 0; i<len(s.items); i++ {
+			it := s.items[i]
+			sym := it.next()
+			switch {
+			case sym==nil: // complete
+				for _,w := range sets[it.origin].items {
+					if w.next()==it.prod.LHS { s.add(item{w.prod,w.dot+1,w.origin}) }
+				}
+			case sym.Terminal: // scan
+				if k<len(toks) && sym.match(toks[k]) { sets[k+1].add(item{it.prod,it.dot+1,it.origin}) }
+			default: // predict
+				for _,pr := range sym.prods { s.add(item{pr,0,k}) }
+				if sym.nullable { s.add(item{it.prod,it.dot+1,it.origin}) }
+			}
+		}
+		if len(s.items)>0 { last = k }
+	}
+	
+	n := len(toks)
+	f := &forest{g:g,toks:toks,sets:sets,nodes:make(map[nodeKey]*Node)}
+	if !f.derives(g.Start,0,n) {
+		e := &Error{}
+		if last<n {
+			e.Token = toks[last]
+			e.Pos = toks[last].Pos
+		} else if n>0 {
+			e.Pos = toks[n-1].Pos
+		}
+		return nil,e
+	}
+	return f.symbolNode(g.Start,0,n),nil
+}
+
+/*
+A node of the shared packed parse forest. Symbol nodes represent a symbol,
+that derives the tokens [Start,End); intermediate nodes (Symbol==nil) the
+first symbols of a production. Every packed alternative is one way to derive
+the node.
+*/
+type Node struct{
+	Symbol *Symbol
+	Start,End int
+	Token *scanlist.Element // for terminals
+	Alts []*Packed
+	
+	prod *Production // for intermediate nodes
+	dot int
+}
+
+// Reports, whether the node has more than one derivation.
+func (n *Node) Ambiguous() bool { return len(n.Alts)>1 }
+
+func (n *Node) String() string {
+	if n.Symbol==nil { return fmt.Sprintf("%v•%d[%d,%d)",n.prod,n.dot,n.Start,n.End) }
+	return fmt.Sprintf("%v[%d,%d)",n.Symbol,n.Start,n.End)
+}
+
+/*
+A packed node: one derivation of its parent by the production Prod. Left
+derives the leading symbols (or is nil), Right the last symbol (nil for
+empty productions).
+*/
+type Packed struct{
+	Prod *Production
+	Left,Right *Node
+}
+
+type nodeKey struct{
+	sym *Symbol
+	prod *Production
+	dot int
+	start,end int
+}
+
+type forest struct{
+	g *Grammar
+	toks []*scanlist.Element
+	sets []*set
+	nodes map[nodeKey]*Node
+}
+
+// Reports, whether sym derives the tokens [i,j).
+func (f *forest) derives(sym *Symbol,i,j int) bool {
+	if sym.Terminal { return j==i+1 && sym.match(f.toks[i]) }
+	for _,pr := range sym.prods {
+		if f.sets[j].has[item{pr,len(pr.RHS),i}] { return true }
+	}
+	return false
+}
+
+func (f *forest) symbolNode(sym *Symbol,i,j int) *Node {
+	key := nodeKey{sym:sym,start:i,end:j}
+	if n,ok := f.nodes[key]; ok { return n }
+	n := &Node{Symbol:sym,Start:i,End:j}
+	f.nodes[key] = n
+	if sym.Terminal {
+		n.Token = f.toks[i]
+		return n
+	}
+	for _,pr := range sym.prods {
+		if !f.sets[j].has[item{pr,len(pr.RHS),i}] { continue }
+		if len(pr.RHS)==0 {
+			n.Alts = append(n.Alts,&Packed{Prod:pr})
+			continue
+		}
+		n.Alts = append(n.Alts,f.splits(pr,len(pr.RHS),i,j)...)
+	}
+	return n
+}
+
+// The node for the first d symbols of pr, deriving [i,j).
+func (f *forest) prefixNode(pr *Production,d,i,j int) *Node {
+	if d==1 { return f.symbolNode(pr.RHS[0],i,j) }
+	key := nodeKey{prod:pr,dot:d,start:i,end:j}
+	if n,ok := f.nodes[key]; ok { return n }
+	n := &Node{Start:i,End:j,prod:pr,dot:d}
+	f.nodes[key] = n
+	n.Alts = f.splits(pr,d,i,j)
+	return n
+}
+
+// All ways, the first d (>0) symbols of pr derive [i,j).
+func (f *forest) splits(pr *Production,d,i,j int) (alts []*Packed) {
+	last := pr.RHS[d-1]
+	for k := i; k<=j; k++ {
+		if d==1 {
+			if k!=i { break }
+		} else if !f.sets[k].has[item{pr,d-1,i}] {
+			continue
+		}
+		if !f.derives(last,k,j) { continue }
+		var left *Node
+		if d>1 { left = f.prefixNode(pr,d-1,i,k) }
+		alts = append(alts,&Packed{pr,left,f.symbolNode(last,k,j)})
+	}
+	return
+}
+
+func textify(e *scanlist.Element) string {
+	if e==nil { return parser.Textify(scanner.EOF) }
+	return e.TokenText
+}
@@ -0,0 +1,128 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package earley
+
+import "github.com/byte-mug/semiparse/parser"
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "strings"
+import "testing"
+
+func lex(src string) *scanlist.Element {
+	b := new(scanlist.BaseScanner)
+	b.Init(strings.NewReader(src))
+	return b.Next()
+}
+
+func compile(t *testing.T,p *parser.Parser,start string) *Grammar {
+	g,err := Compile(p,start)
+	if err!=nil { t.Fatal(err) }
+	return g
+}
+
+func count(t *testing.T,g *Grammar,src string) int {
+	f,err := g.Parse(lex(src))
+	if err!=nil { t.Fatalf("%q: %v",src,err) }
+	k := 0
+	f.Trees(func(*Tree) bool { k++; return true })
+	if k!=f.Count() { t.Errorf("%q: Count()=%d, but %d trees",src,f.Count(),k) }
+	return k
+}
+
+// E -> E '+' E | Ident has Catalan-many parses.
+func TestAmbiguity(t *testing.T) {
+	p := new(parser.Parser).Construct()
+	p.Define("E",false,parser.LSeq{parser.Delegate("E"),parser.Required{'+',nil},parser.Delegate("E")})
+	p.Define("E",false,parser.Required{scanner.Ident,nil})
+	g := compile(t,p,"E")
+	for i,n := range []int{1,1,2,5,14,42} {
+		src := strings.Repeat("a+",i)+"a"
+		if c := count(t,g,src); c!=n { t.Errorf("%q: %d parses, want %d",src,c,n) }
+	}
+	f,_ := g.Parse(lex("a+b"))
+	if f.Ambiguous() { t.Error("a+b: ambiguous") }
+	if s := f.Disambiguate(nil).String(); s!="E(E(a) + E(b))" { t.Errorf("a+b: %s",s) }
+}
+
+// S -> A A Ident, A -> '+'*: the '+'s split between both As.
+func TestNullable(t *testing.T) {
+	p := new(parser.Parser).Construct()
+	p.Define("S",false,parser.LSeq{parser.Delegate("A"),parser.Delegate("A"),parser.Required{scanner.Ident,nil}})
+	p.Define("A",false,parser.LStar{parser.Required{'+',nil}})
+	g := compile(t,p,"S")
+	for i,n := range []int{1,2,3,4} {
+		src := strings.Repeat("+",i)+"x"
+		if c := count(t,g,src); c!=n { t.Errorf("%q: %d parses, want %d",src,c,n) }
+	}
+}
+
+func TestLeftRecursion(t *testing.T) {
+	p := new(parser.Parser).Construct()
+	p.Define("E",false,parser.Required{scanner.Ident,nil})
+	p.Define("E",true,parser.LSeq{parser.Required{'-',nil},parser.Required{scanner.Ident,nil}})
+	g := compile(t,p,"E")
+	f,err := g.Parse(lex("a-b-c"))
+	if err!=nil { t.Fatal(err) }
+	if f.Count()!=1 { t.Errorf("%d parses",f.Count()) }
+	if s := f.Disambiguate(nil).String(); s!="E(E(E(a) - b) - c)" { t.Errorf("got %s",s) }
+}
+
+func TestError(t *testing.T) {
+	p := new(parser.Parser).Construct()
+	p.Define("E",false,parser.LSeq{parser.Delegate("E"),parser.Required{'+',nil},parser.Delegate("E")})
+	p.Define("E",false,parser.Required{scanner.Ident,nil})
+	g := compile(t,p,"E")
+	// Token positions are those of the scanner, behind the token.
+	for _,c := range []struct{ src, tok string; line, col int }{
+		{"a b",     "b", 1,4},
+		{"a+\n+b",  "+", 2,2},
+		{"a+",      "",  1,3}, // at the end: the position of the last token
+		{"+",       "+", 1,2},
+	} {
+		_,err := g.Parse(lex(c.src))
+		e,ok := err.(*Error)
+		if !ok { t.Errorf("%q: got %v",c.src,err); continue }
+		tok := ""
+		if e.Token!=nil { tok = e.Token.TokenText }
+		if tok!=c.tok || e.Pos.Line!=c.line || e.Pos.Column!=c.col {
+			t.Errorf("%q: %q at %d:%d, want %q at %d:%d",c.src,tok,e.Pos.Line,e.Pos.Column,c.tok,c.line,c.col)
+		}
+	}
+}
+
+// Switch cases compile in the order of their tokens, not in map order.
+func TestSwitchOrder(t *testing.T) {
+	p := new(parser.Parser).Construct()
+	cases := make(map[rune]parser.ParseRule)
+	for _,c := range "-+*/%^&|" { cases[c] = parser.Required{c,nil} }
+	p.Define("S",false,parser.Switch{Cases:cases})
+	var want string
+	for i := 0; i<20; i++ {
+		g := compile(t,p,"S")
+		s := ""
+		for _,pr := range g.Productions { s += pr.String()+";" }
+		if i==0 { want = s } else if s!=want { t.Fatalf("got %s, want %s",s,want) }
+	}
+}
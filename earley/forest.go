@@ -0,0 +1,152 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package earley
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "strings"
+import "fmt"
+
+/*
+A parse tree. Anonymous nonterminals are spliced into their parents, so only
+rules and tokens remain.
+*/
+type Tree struct{
+	Name string
+	Start,End int
+	Token *scanlist.Element // for terminals
+	Children []*Tree
+}
+func (t *Tree) String() string {
+	if t.Token!=nil { return t.Token.TokenText }
+	s := make([]string,len(t.Children))
+	for i,c := range t.Children { s[i] = c.String() }
+	return fmt.Sprint(t.Name,"(",strings.Join(s," "),")")
+}
+
+// Counts the trees in the forest. Cyclic (infinitely ambiguous) forests count as -1.
+func (n *Node) Count() int {
+	c := counter{make(map[*Node]int),make(map[*Node]bool)}
+	return c.count(n)
+}
+
+type counter struct{
+	memo map[*Node]int
+	path map[*Node]bool
+}
+func (c *counter) count(n *Node) int {
+	if n==nil { return 1 }
+	if v,ok := c.memo[n]; ok { return v }
+	if c.path[n] { return -1 }
+	if n.Token!=nil { return 1 }
+	c.path[n] = true
+	sum := 0
+	for _,a := range n.Alts {
+		l,r := c.count(a.Left),c.count(a.Right)
+		if l<0 || r<0 { sum = -1; break }
+		sum += l*r
+	}
+	delete(c.path,n)
+	c.memo[n] = sum
+	return sum
+}
+
+/*
+Enumerates the trees of the forest, until yield returns false. Derivations
+that run in a cycle are skipped, so the enumeration is finite.
+*/
+func (n *Node) Trees(yield func(*Tree) bool) {
+	e := enumerator{make(map[*Node]bool)}
+	e.node(n,func(ts []*Tree) bool {
+		return yield(ts[0])
+	})
+}
+
+type enumerator struct{
+	path map[*Node]bool
+}
+
+// Calls k with every sequence of trees, n contributes to its parent.
+func (e *enumerator) node(n *Node,k func([]*Tree) bool) bool {
+	if n==nil { return k(nil) }
+	if n.Token!=nil { return k([]*Tree{{Name:n.Symbol.Name,Start:n.Start,End:n.End,Token:n.Token}}) }
+	if e.path[n] { return true }
+	e.path[n] = true
+	defer delete(e.path,n)
+	for _,a := range n.Alts {
+		ok := e.node(a.Left,func(l []*Tree) bool {
+			return e.node(a.Right,func(r []*Tree) bool {
+				ts := make([]*Tree,0,len(l)+len(r))
+				ts = append(append(ts,l...),r...)
+				if n.Symbol!=nil && !n.Symbol.anon { ts = []*Tree{{Name:n.Symbol.Name,Start:n.Start,End:n.End,Children:ts}} }
+				// k continues with the siblings of n, which aren't inside n.
+				delete(e.path,n)
+				defer func() { e.path[n] = true }()
+				return k(ts)
+			})
+		})
+		if !ok { return false }
+	}
+	return true
+}
+
+/*
+Selects one tree from the forest. At every ambiguous node, choose is asked to
+pick one of the alternatives; if choose is nil or returns nil, the first one,
+that doesn't run in a cycle, is taken.
+*/
+func (n *Node) Disambiguate(choose func(n *Node) *Packed) *Tree {
+	d := disambiguator{choose,make(map[*Node]bool)}
+	ts,ok := d.node(n)
+	if !ok { return nil }
+	return ts[0]
+}
+
+type disambiguator struct{
+	choose func(n *Node) *Packed
+	path map[*Node]bool
+}
+
+func (d *disambiguator) node(n *Node) ([]*Tree,bool) {
+	if n==nil { return nil,true }
+	if n.Token!=nil { return []*Tree{{Name:n.Symbol.Name,Start:n.Start,End:n.End,Token:n.Token}},true }
+	if d.path[n] { return nil,false }
+	d.path[n] = true
+	defer delete(d.path,n)
+	
+	alts := n.Alts
+	if len(alts)>1 && d.choose!=nil {
+		if a := d.choose(n); a!=nil { alts = []*Packed{a} }
+	}
+	for _,a := range alts {
+		l,ok := d.node(a.Left)
+		if !ok { continue }
+		r,ok := d.node(a.Right)
+		if !ok { continue }
+		ts := append(l,r...)
+		if n.Symbol==nil || n.Symbol.anon { return ts,true }
+		return []*Tree{{Name:n.Symbol.Name,Start:n.Start,End:n.End,Children:ts}},true
+	}
+	return nil,false
+}
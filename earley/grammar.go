@@ -0,0 +1,261 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+An Earley parser, that yields all parses of a (possibly ambiguous) grammar as
+a shared packed parse forest. Grammars are compiled from the combinators of a
+parser.Parser; opaque rules (Pfunc, Action, typed rules) are rejected.
+*/
+package earley
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/parser"
+import "strconv"
+import "sort"
+import "fmt"
+
+// A grammar symbol: a nonterminal or a terminal.
+type Symbol struct{
+	Name string
+	Terminal bool
+	
+	// Rule names are empty for anonymous nonterminals (OR, '*', ...).
+	anon bool
+	
+	// Terminals: the token kind or, if Text!="", the token text, or
+	// a character class (Range, Set, NotSet), if Class!=nil.
+	Token rune
+	Text string
+	Class parser.ParseRule
+	
+	id int
+	prods []*Production
+	nullable bool
+}
+func (s *Symbol) String() string { return s.Name }
+
+// Reports, whether the symbol is an anonymous helper nonterminal.
+func (s *Symbol) Anonymous() bool { return s.anon }
+
+func (s *Symbol) match(e *scanlist.Element) bool {
+	if s.Class!=nil { return s.Class.Parse(nil,e,nil).Ok() }
+	if s.Text!="" { return e.TokenText==s.Text }
+	return e.Token==s.Token
+}
+
+// A context-free production LHS -> RHS.
+type Production struct{
+	LHS *Symbol
+	RHS []*Symbol
+	id int
+}
+func (p *Production) String() string {
+	return fmt.Sprint(p.LHS," -> ",p.RHS)
+}
+
+// A context-free grammar, compiled by Compile().
+type Grammar struct{
+	Start *Symbol
+	Symbols []*Symbol
+	Productions []*Production
+	
+	p *parser.Parser
+	named map[string]*Symbol
+	terms map[string]*Symbol
+}
+
+/*
+Compiles the rules of p, that are reachable from start, into a context-free
+grammar. The combinators are translated as follows:
+	Delegate(n)                 the rule n, with its left-recursive alternatives as N -> N T
+	DelegateNoLeftRecursion(n)  the rule n, without its left-recursive alternatives
+	Required, RequireText       a terminal
+	Range, Set, NotSet          a terminal
+	Literal                     a sequence of terminals
+	OR, Switch                  alternatives (Switch doesn't restrict them by the next token)
+	LSeq, ArraySeq              a sequence
+	LStar, LPlus, ...           repetitions
+	First                       its Inner rule
+*/
+func Compile(p *parser.Parser,start string) (g *Grammar,err error) {
+	g = &Grammar{p:p,named:make(map[string]*Symbol),terms:make(map[string]*Symbol)}
+	defer func() {
+		if r := recover(); r!=nil {
+			e,ok := r.(compileError)
+			if !ok { panic(r) }
+			g,err = nil,e
+		}
+	}()
+	g.Start = g.rule(p.Resolve(start),true)
+	g.nullables()
+	return
+}
+
+type compileError struct{ msg string }
+func (c compileError) Error() string { return "semiparse/earley: "+c.msg }
+
+func (g *Grammar) symbol(s *Symbol) *Symbol {
+	s.id = len(g.Symbols)
+	g.Symbols = append(g.Symbols,s)
+	return s
+}
+func (g *Grammar) anon() *Symbol {
+	return g.symbol(&Symbol{Name:fmt.Sprint("_",len(g.Symbols)),anon:true})
+}
+func (g *Grammar) prod(lhs *Symbol,rhs ...*Symbol) {
+	pr := &Production{lhs,rhs,len(g.Productions)}
+	g.Productions = append(g.Productions,pr)
+	lhs.prods = append(lhs.prods,pr)
+}
+
+// Returns the nonterminal of the absolute rule n.
+func (g *Grammar) rule(n string,left bool) *Symbol {
+	key := n
+	if !left { key += "!" }
+	if s,ok := g.named[key]; ok { return s }
+	s := g.symbol(&Symbol{Name:n})
+	g.named[key] = s
+	phase1,phase2 := g.p.Alternatives("."+n)
+	if phase1==nil && phase2==nil { panic(compileError{"rule not defined: "+n}) }
+	q := g.p.RuleModule(n)
+	for _,r := range phase1 { g.prod(s,g.seq(q,r)...) }
+	if left {
+		for _,r := range phase2 { g.prod(s,append([]*Symbol{s},g.seq(q,r)...)...) }
+	}
+	return s
+}
+
+func (g *Grammar) terminal(tok rune,text string) *Symbol {
+	key := strconv.Itoa(int(tok))+":"+text
+	if s,ok := g.terms[key]; ok { return s }
+	s := &Symbol{Terminal:true,Token:tok,Text:text,Name:parser.Textify(tok)}
+	if text!="" { s.Name = strconv.Quote(text) }
+	g.terms[key] = g.symbol(s)
+	return s
+}
+
+func (g *Grammar) class(r parser.ParseRule) *Symbol {
+	key := parser.RuleName(r)
+	if s,ok := g.terms[key]; ok { return s }
+	s := &Symbol{Terminal:true,Class:r,Name:key}
+	g.terms[key] = g.symbol(s)
+	return s
+}
+
+// Translates r into a sequence of symbols.
+func (g *Grammar) seq(q *parser.Parser,r parser.ParseRule) []*Symbol {
+	switch v := r.(type) {
+	case parser.LSeq:
+		var s []*Symbol
+		for _,r := range v { s = append(s,g.seq(q,r)...) }
+		return s
+	case parser.ArraySeq:
+		var s []*Symbol
+		for _,r := range v { s = append(s,g.seq(q,r)...) }
+		return s
+	case parser.First:
+		return g.seq(q,v.Inner)
+	case parser.Capture:
+		return g.seq(q,v.Inner)
+	case parser.Literal:
+		var s []*Symbol
+		for _,c := range v { s = append(s,g.terminal(c,"")) }
+		return s
+	}
+	return []*Symbol{g.sym(q,r)}
+}
+
+// Translates r into a single symbol.
+func (g *Grammar) sym(q *parser.Parser,r parser.ParseRule) *Symbol {
+	switch v := r.(type) {
+	case parser.Required:
+		return g.terminal(v.Token,"")
+	case parser.RequireText:
+		return g.terminal(0,v.Text)
+	case parser.Range,parser.Set,parser.NotSet:
+		return g.class(r)
+	case parser.Delegate:
+		return g.rule(q.Resolve(string(v)),true)
+	case parser.DelegateNoLeftRecursion:
+		return g.rule(q.Resolve(string(v)),false)
+	case *parser.ParamDelegate:
+		return g.rule(v.Instance(q),true)
+	case parser.OR:
+		s := g.anon()
+		for _,r := range v { g.prod(s,g.seq(q,r)...) }
+		return s
+	case parser.Switch:
+		s := g.anon()
+		ks := make([]int,0,len(v.Cases))
+		for k := range v.Cases { ks = append(ks,int(k)) }
+		sort.Ints(ks) // Map order is random; keep the productions deterministic.
+		for _,k := range ks { g.prod(s,g.seq(q,v.Cases[rune(k)])...) }
+		if v.Default!=nil { g.prod(s,g.seq(q,v.Default)...) }
+		return s
+	case parser.LStar:
+		return g.star(q,v.Inner,true)
+	case parser.ArrayStar:
+		return g.star(q,v.Inner,true)
+	case parser.LPlus:
+		return g.star(q,v.Inner,false)
+	case parser.ArrayPlus:
+		return g.star(q,v.Inner,false)
+	case parser.TokenFinishedOptional:
+		s := g.anon()
+		t := g.terminal(v.Token,"")
+		g.prod(s,t)
+		g.prod(s,append(g.seq(q,v.Inner),t)...)
+		return s
+	case parser.LSeq,parser.ArraySeq,parser.First,parser.Capture,parser.Literal:
+		s := g.anon()
+		g.prod(s,g.seq(q,r)...)
+		return s
+	}
+	panic(compileError{fmt.Sprintf("opaque rule %s",parser.RuleName(r))})
+}
+
+// S -> S X | X (plus S -> <empty>, if empty is set)
+func (g *Grammar) star(q *parser.Parser,r parser.ParseRule,empty bool) *Symbol {
+	s := g.anon()
+	x := g.seq(q,r)
+	if empty {
+		g.prod(s)
+	} else {
+		g.prod(s,x...)
+	}
+	g.prod(s,append([]*Symbol{s},x...)...)
+	return s
+}
+
+func (g *Grammar) nullables() {
+	for changed := true; changed; {
+		changed = false
+		for _,pr := range g.Productions {
+			if pr.LHS.nullable { continue }
+			n := true
+			for _,s := range pr.RHS { n = n && s.nullable }
+			if n { pr.LHS.nullable,changed = true,true }
+		}
+	}
+}
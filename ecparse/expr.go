@@ -85,6 +85,6 @@ func c_expr_trailer_ocx(p *parser.Parser,tokens *scanlist.Element, left interfac
 }
 
 func RegisterExprOCX(p *parser.Parser) {
-	p.DefineBefore("Expr",true,parser.Pfunc(c_expr_trailer_ocx))
+	p.DefineBefore("Expr",true,parser.Pfunc(c_expr_trailer_ocx).First('.','['/*]*/))
 }
 
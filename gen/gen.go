@@ -0,0 +1,428 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+Compiles a grammar, built with the combinators of package parser, into Go
+source code. The generated code calls rules directly and inlines token checks,
+yet produces the same ParserResult values as the interpreted Parser.
+
+Opaque rules (Pfunc) are called by name, so they must either be exported or
+be part of the package, the code is generated into.
+*/
+package gen
+
+import "github.com/byte-mug/semiparse/parser"
+import "reflect"
+import "runtime"
+import "strings"
+import "strconv"
+import "sort"
+import "bytes"
+import "fmt"
+import "io"
+import "go/format"
+
+const parserPath = "github.com/byte-mug/semiparse/parser"
+
+type Config struct{
+	Package string // The name of the generated package.
+	ImportPath string // The import path of the generated package, if any.
+	Prefix string // Prefix for all generated identifiers. Defaults to "g_".
+	Register string // Name of the generated registration function. Defaults to "Register".
+}
+
+type generator struct{
+	cfg *Config
+	p *parser.Parser
+	body bytes.Buffer
+	imports map[string]string // path -> alias
+	aliases map[string]bool
+	ruleIdx map[string]int
+	nodes int
+	cur *parser.Parser // the module view of the current rule
+}
+
+func (g *generator) errorf(f string,a ...interface{}) error {
+	return fmt.Errorf("semiparse/gen: "+f,a...)
+}
+
+func (g *generator) ident(s string) string {
+	b := []byte(s)
+	for i,c := range b {
+		switch {
+		case c>='a'&&c<='z',c>='A'&&c<='Z',c>='0'&&c<='9',c=='_':
+		default: b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func (g *generator) qualify(path, name string) string {
+	if path==g.cfg.ImportPath { return name }
+	a,ok := g.imports[path]
+	if !ok {
+		a = path[strings.LastIndex(path,"/")+1:]
+		a = g.ident(a)
+		base := a
+		for i := 1; g.aliases[a] || a=="p" || a=="tokens" || a=="left" ; i++ { a = fmt.Sprint(base,i) }
+		g.aliases[a] = true
+		g.imports[path] = a
+	}
+	return a+"."+name
+}
+
+// Resolves a function value into a qualified Go expression.
+func (g *generator) funcName(f interface{}) (string,error) {
+	v := reflect.ValueOf(f)
+	if v.IsNil() { return "nil",nil }
+	rf := runtime.FuncForPC(v.Pointer())
+	if rf==nil { return "",g.errorf("unnamed function %v",f) }
+	full := rf.Name()
+	slash := strings.LastIndex(full,"/")+1
+	dot := strings.Index(full[slash:],".")
+	if dot<0 { return "",g.errorf("unresolvable function %s",full) }
+	path,name := full[:slash+dot],full[slash+dot+1:]
+	if strings.ContainsAny(name,".[-") { return "",g.errorf("cannot reference closure or method %s",full) }
+	if path!=g.cfg.ImportPath && !(name[0]>='A'&&name[0]<='Z') {
+		return "",g.errorf("cannot reference unexported function %s",full)
+	}
+	return g.qualify(path,name),nil
+}
+
+func (g *generator) runeLit(r rune) string {
+	if r>=0 && strconv.IsPrint(r) { return strconv.QuoteRune(r) }
+	return fmt.Sprintf("rune(%d) /* %s */",r,strings.Replace(parser.Textify(r),"*/","* /",-1))
+}
+
+// Returns a Go expression for a character-class combinator.
+func (g *generator) literal(r parser.ParseRule) string {
+	P := func(n string) string { return g.qualify(parserPath,n) }
+	switch v := r.(type) {
+	case parser.Range: return fmt.Sprintf("%s{Lo:%s,Hi:%s}",P("Range"),g.runeLit(v.Lo),g.runeLit(v.Hi))
+	case parser.Set: return fmt.Sprintf("%s(%q)",P("Set"),string(v))
+	case parser.NotSet: return fmt.Sprintf("%s(%q)",P("NotSet"),string(v))
+	case parser.Literal: return fmt.Sprintf("%s(%q)",P("Literal"),string(v))
+	}
+	panic("not a character class")
+}
+
+func (g *generator) ruleFunc(n string, suffix string) string {
+	return fmt.Sprintf("%sr%d_%s%s",g.cfg.Prefix,g.ruleIdx[n],g.ident(n),suffix)
+}
+
+func (g *generator) newNode() string {
+	g.nodes++
+	return fmt.Sprintf("%sn%d",g.cfg.Prefix,g.nodes)
+}
+
+func (g *generator) header(name string) {
+	fmt.Fprintf(&g.body,"func %s(p *%s,tokens *%s, left interface{}) (%s) {\n",name,
+		g.qualify(parserPath,"Parser"),g.qualify(scanlistPath,"Element"),g.qualify(parserPath,"ParserResult"))
+}
+
+const scanlistPath = "github.com/byte-mug/semiparse/scanlist"
+
+/*
+Emits code for r and returns the name of a function with the signature of
+parser.Pfunc, that implements r.
+*/
+func (g *generator) node(r parser.ParseRule) (string,error) {
+	P := func(n string) string { return g.qualify(parserPath,n) }
+	switch v := r.(type) {
+	case parser.Pfunc:
+		return g.funcName(v)
+	case parser.First:
+		return g.node(v.Inner)
+	case parser.Delegate:
+		name := g.newNode()
+		g.header(name)
+		if _,ok := g.ruleIdx[g.cur.Resolve(string(v))]; ok {
+			fmt.Fprintf(&g.body,"\treturn %s(p,tokens)\n}\n\n",g.ruleFunc(g.cur.Resolve(string(v)),""))
+		} else {
+			fmt.Fprintf(&g.body,"\treturn p.Match(%q,tokens)\n}\n\n",string(v))
+		}
+		return name,nil
+	case *parser.ParamDelegate:
+		return g.node(parser.Delegate("."+v.Instance(g.cur)))
+	case parser.DelegateNoLeftRecursion:
+		name := g.newNode()
+		g.header(name)
+		if _,ok := g.ruleIdx[g.cur.Resolve(string(v))]; ok {
+			fmt.Fprintf(&g.body,"\treturn %s(tokens,%s(p,tokens,nil))\n}\n\n",g.qualify(parserPath,"LexicalError"),g.ruleFunc(g.cur.Resolve(string(v)),"_1"))
+		} else {
+			fmt.Fprintf(&g.body,"\treturn p.MatchNoLeftRecursion(%q,tokens)\n}\n\n",string(v))
+		}
+		return name,nil
+	case parser.Action:
+		fn,err := g.funcName(v.F)
+		if err!=nil { return "",err }
+		inner,err := g.node(v.Inner)
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\treturn %s(%s(p,tokens,left),tokens,left)\n}\n\n",fn,inner)
+		return name,nil
+	case parser.Switch:
+		keys := make([]int,0,len(v.Cases))
+		for k := range v.Cases { keys = append(keys,int(k)) }
+		sort.Ints(keys)
+		cases := make([]string,len(keys))
+		for i,k := range keys {
+			c,err := g.node(v.Cases[rune(k)])
+			if err!=nil { return "",err }
+			cases[i] = c
+		}
+		def := ""
+		if v.Default!=nil {
+			d,err := g.node(v.Default)
+			if err!=nil { return "",err }
+			def = d
+		}
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\tswitch tokens.SafeToken() {\n")
+		for i,k := range keys {
+			fmt.Fprintf(&g.body,"\tcase %s: return %s(p,tokens,left)\n",g.runeLit(rune(k)),cases[i])
+		}
+		fmt.Fprintf(&g.body,"\t}\n")
+		if def=="" {
+			fmt.Fprintf(&g.body,"\treturn %s(\"no rules!\",tokens.SafePos())\n}\n\n",P("ResultFail"))
+		} else {
+			fmt.Fprintf(&g.body,"\treturn %s(p,tokens,left)\n}\n\n",def)
+		}
+		return name,nil
+	case parser.Required:
+		errf,err := g.funcName(v.Errf)
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\tif tokens!=nil && tokens.Token==%s { return %s(tokens.Next(),tokens.TokenText) }\n",g.runeLit(v.Token),P("ResultOk"))
+		fmt.Fprintf(&g.body,"\treturn %s{Token:%s,Errf:%s}.Parse(p,tokens,left)\n}\n\n",P("Required"),g.runeLit(v.Token),errf)
+		return name,nil
+	case parser.RequireText:
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\tif tokens!=nil && tokens.TokenText==%q { return %s(tokens.Next(),tokens.TokenText) }\n",v.Text,P("ResultOk"))
+		fmt.Fprintf(&g.body,"\treturn %s{Text:%q}.Parse(p,tokens,left)\n}\n\n",P("RequireText"),v.Text)
+		return name,nil
+	case parser.Range,parser.Set,parser.NotSet,parser.Literal:
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\treturn %s.Parse(p,tokens,left)\n}\n\n",g.literal(v))
+		return name,nil
+	case parser.Capture:
+		inner,err := g.node(v.Inner)
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\tres := %s(p,tokens,left)\n\tif res.Result==%s { res.Data = %s(tokens,res.Next) }\n\treturn res\n}\n\n",inner,P("RESULT_OK"),P("TextBetween"))
+		return name,nil
+	case parser.TokenFinishedOptional:
+		inner,err := g.node(v.Inner)
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\tif tokens.SafeToken()==%s { return %s(tokens.Next(),nil) }\n",g.runeLit(v.Token),P("ResultOk"))
+		fmt.Fprintf(&g.body,"\tir := %s(p,tokens,left)\n\tif ir.Result!=%s { return ir }\n",inner,P("RESULT_OK"))
+		fmt.Fprintf(&g.body,"\tif ir.Next!=nil && ir.Next.Token==%s { ir.Next = ir.Next.Next(); return ir }\n",g.runeLit(v.Token))
+		fmt.Fprintf(&g.body,"\terr,_ := %s(%s,ir.Next,%s)\n",P("Match"),P("Textify"),g.runeLit(v.Token))
+		fmt.Fprintf(&g.body,"\treturn %s(%s(err),ir.Next.SafePos())\n}\n\n",P("ResultFail"),g.qualify("fmt","Sprint"))
+		return name,nil
+	case parser.OR:
+		alts,err := g.nodes_(v)
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		if len(alts)==0 {
+			fmt.Fprintf(&g.body,"\treturn %s(\"no rules!\",tokens.SafePos())\n}\n\n",P("ResultFail"))
+			return name,nil
+		}
+		for _,a := range alts[:len(alts)-1] {
+			fmt.Fprintf(&g.body,"\tif npr := %s(p,tokens,left); npr.Result!=%s { return npr }\n",a,P("RESULT_FAILED"))
+		}
+		fmt.Fprintf(&g.body,"\treturn %s(p,tokens,left)\n}\n\n",alts[len(alts)-1])
+		return name,nil
+	case parser.LSeq:
+		elems,err := g.nodes_(v)
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\topr := %s(tokens,left)\n",P("ResultOk"))
+		for _,e := range elems {
+			fmt.Fprintf(&g.body,"\topr = %s(p,opr.Next,opr.Data)\n\tif opr.Result!=%s { return opr }\n",e,P("RESULT_OK"))
+		}
+		fmt.Fprintf(&g.body,"\treturn opr\n}\n\n")
+		return name,nil
+	case parser.ArraySeq:
+		elems,err := g.nodes_(v)
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		fmt.Fprintf(&g.body,"\tvar opr %s\n\tarr := make([]interface{},%d)\n",P("ParserResult"),len(elems))
+		for i,e := range elems {
+			fmt.Fprintf(&g.body,"\topr = %s(p,tokens,left)\n\tif opr.Result!=%s { return opr }\n\ttokens = opr.Next\n\tarr[%d] = opr.Data\n",e,P("RESULT_OK"),i)
+		}
+		fmt.Fprintf(&g.body,"\topr.Data = arr\n\treturn opr\n}\n\n")
+		return name,nil
+	case parser.LStar,parser.LPlus:
+		var inner string
+		var err error
+		plus := false
+		if s,ok := v.(parser.LStar); ok { inner,err = g.node(s.Inner) } else { inner,err = g.node(v.(parser.LPlus).Inner); plus = true }
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		if plus {
+			fmt.Fprintf(&g.body,"\topr := %s(p,tokens,left)\n\tif opr.Result!=%s { return opr }\n\ttokens = opr.Next\n",inner,P("RESULT_OK"))
+		} else {
+			fmt.Fprintf(&g.body,"\topr := %s(tokens,left)\n",P("ResultOk"))
+		}
+		fmt.Fprintf(&g.body,"\tfor {\n\t\tnpr := %s(p,tokens,left)\n",inner)
+		fmt.Fprintf(&g.body,"\t\tswitch npr.Result {\n\t\tcase %s: return opr\n\t\tcase %s: return npr\n\t\t}\n",P("RESULT_FAILED"),P("RESULT_FAILED_CUT"))
+		fmt.Fprintf(&g.body,"\t\topr = npr\n\t\tleft = npr.Data\n\t\ttokens = npr.Next\n\t}\n}\n\n")
+		return name,nil
+	case parser.ArrayStar,parser.ArrayPlus:
+		var inner string
+		var err error
+		plus := false
+		if s,ok := v.(parser.ArrayStar); ok { inner,err = g.node(s.Inner) } else { inner,err = g.node(v.(parser.ArrayPlus).Inner); plus = true }
+		if err!=nil { return "",err }
+		name := g.newNode()
+		g.header(name)
+		if plus {
+			fmt.Fprintf(&g.body,"\tnpr := %s(p,tokens,nil)\n\tif npr.Result!=%s { return npr }\n\ttokens = npr.Next\n\tdok := []interface{}{npr.Data}\n",inner,P("RESULT_OK"))
+		} else {
+			fmt.Fprintf(&g.body,"\tdok := []interface{}{}\n")
+		}
+		fmt.Fprintf(&g.body,"\tfor {\n\t\tnpr := %s(p,tokens,nil)\n",inner)
+		fmt.Fprintf(&g.body,"\t\tswitch npr.Result {\n\t\tcase %s: return %s(tokens,dok)\n\t\tcase %s: return npr\n\t\t}\n",P("RESULT_FAILED"),P("ResultOk"),P("RESULT_FAILED_CUT"))
+		fmt.Fprintf(&g.body,"\t\tdok = append(dok,npr.Data)\n\t\ttokens = npr.Next\n\t}\n}\n\n")
+		return name,nil
+	}
+	return "",g.errorf("cannot generate code for %T",r)
+}
+
+func (g *generator) nodes_(rs []parser.ParseRule) ([]string,error) {
+	names := make([]string,len(rs))
+	for i,r := range rs {
+		n,err := g.node(r)
+		if err!=nil { return nil,err }
+		names[i] = n
+	}
+	return names,nil
+}
+
+func (g *generator) rule(n string) error {
+	g.cur = g.p.RuleModule(n)
+	phase1,phase2 := g.p.Alternatives(n)
+	r1,err := g.node(parser.OR(phase1))
+	if err!=nil { return fmt.Errorf("rule %q: %v",n,err) }
+	r2,err := g.node(parser.OR(phase2))
+	if err!=nil { return fmt.Errorf("rule %q: %v",n,err) }
+	P := func(n string) string { return g.qualify(parserPath,n) }
+	
+	fmt.Fprintf(&g.body,"// Rule %q.\n",n)
+	fmt.Fprintf(&g.body,"func %s(p *%s,tokens *%s) %s {\n",g.ruleFunc(n,""),P("Parser"),g.qualify(scanlistPath,"Element"),P("ParserResult"))
+	if ns := g.cur.Namespace(); ns!="" {
+		fmt.Fprintf(&g.body,"\tif p.Namespace()!=%q { p = p.In(%q) }\n",ns,ns)
+	}
+	fmt.Fprintf(&g.body,"\topr := %s(p,tokens,nil)\n\tif opr.Result!=%s { return %s(tokens,opr) }\n",r1,P("RESULT_OK"),P("LexicalError"))
+	fmt.Fprintf(&g.body,"\topr = %s(opr.Next,opr.Data)\n",P("ResultOk"))
+	fmt.Fprintf(&g.body,"\tfor {\n\t\tnpr := %s(p,opr.Next,opr.Data)\n",r2)
+	fmt.Fprintf(&g.body,"\t\tswitch npr.Result {\n\t\tcase %s: return opr\n\t\tcase %s: return npr\n\t\t}\n\t\topr = npr\n\t}\n}\n\n",P("RESULT_FAILED"),P("RESULT_FAILED_CUT"))
+	
+	// The phases are functions (not Pfunc variables), as variables, that refer to themselves, would be initialization cycles.
+	for i,r := range []string{r1,r2} {
+		g.header(g.ruleFunc(n,fmt.Sprint("_",i+1)))
+		if ns := g.cur.Namespace(); ns!="" {
+			fmt.Fprintf(&g.body,"\tif p.Namespace()!=%q { p = p.In(%q) }\n",ns,ns)
+		}
+		fmt.Fprintf(&g.body,"\treturn %s(p,tokens,left)\n}\n\n",r)
+	}
+	return nil
+}
+
+/*
+Writes the Go source of a parser for all rules defined in p. The generated
+source contains a function (named Config.Register) that defines all rules
+in a given Parser. Within the generated code, Delegates call their rules
+directly, bypassing the Parser's rule table (and thus the RuleOptions, that
+only apply to rules, invoked through the Parser).
+*/
+func (cfg Config) Generate(w io.Writer, p *parser.Parser) error {
+	if cfg.Prefix=="" { cfg.Prefix = "g_" }
+	if cfg.Register=="" { cfg.Register = "Register" }
+	if cfg.Package=="" { cfg.Package = "main" }
+	g := &generator{
+		cfg: &cfg,
+		p: p.In(""),
+		imports: make(map[string]string),
+		aliases: make(map[string]bool),
+		ruleIdx: make(map[string]int),
+	}
+	p.InstantiateAll()
+	rules := p.Rules()
+	for i,n := range rules { g.ruleIdx[n] = i }
+	for _,n := range rules {
+		if err := g.rule(n); err!=nil { return err }
+	}
+	P := func(n string) string { return g.qualify(parserPath,n) }
+	fmt.Fprintf(&g.body,"// Defines all generated rules in p.\nfunc %s(p *%s) {\n",cfg.Register,P("Parser"))
+	for _,n := range rules {
+		ns := g.p.RuleModule(n).Namespace()
+		m := "p"
+		if ns!="" { m = fmt.Sprintf("p.In(%q)",ns) }
+		fmt.Fprintf(&g.body,"\t%s.Define(%q,false,%s(%s))\n\t%s.Define(%q,true,%s(%s))\n",m,n[len(ns):],P("Pfunc"),g.ruleFunc(n,"_1"),m,n[len(ns):],P("Pfunc"),g.ruleFunc(n,"_2"))
+		if o := g.p.RuleOptions("."+n); o!=(parser.RuleOptions{}) {
+			fmt.Fprintf(&g.body,"\t%s.DefineWith(%q,%s{Label:%q,Memoize:%v,Hidden:%v,Trace:%v},nil)\n",m,n[len(ns):],P("RuleOptions"),o.Label,o.Memoize,o.Hidden,o.Trace)
+		}
+	}
+	imports := g.p.Imports()
+	froms := make([]string,0,len(imports))
+	for k := range imports { froms = append(froms,k) }
+	sort.Strings(froms)
+	for _,k := range froms {
+		fmt.Fprintf(&g.body,"\tp.Import(%q,%q)\n",k,imports[k])
+	}
+	fmt.Fprintf(&g.body,"}\n")
+	
+	out := new(bytes.Buffer)
+	fmt.Fprintf(out,"// Code generated by semiparse-gen. DO NOT EDIT.\n\npackage %s\n\n",cfg.Package)
+	paths := make([]string,0,len(g.imports))
+	for path := range g.imports { paths = append(paths,path) }
+	sort.Strings(paths)
+	for _,path := range paths {
+		if g.imports[path]==path[strings.LastIndex(path,"/")+1:] {
+			fmt.Fprintf(out,"import %q\n",path)
+		} else {
+			fmt.Fprintf(out,"import %s %q\n",g.imports[path],path)
+		}
+	}
+	fmt.Fprintf(out,"\n")
+	out.Write(g.body.Bytes())
+	src,err := format.Source(out.Bytes())
+	if err!=nil { return g.errorf("%v",err) }
+	_,err = w.Write(src)
+	return err
+}
@@ -0,0 +1,129 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package gen
+
+import "github.com/byte-mug/semiparse/parser"
+import "github.com/byte-mug/semiparse/cparse"
+import "testing"
+import "os"
+import "os/exec"
+import "path/filepath"
+import "strings"
+import "fmt"
+
+const cparsePath = "github.com/byte-mug/semiparse/cparse"
+
+var corpus = []string{
+	"int main(int a, char b) { a = b + c*2; if(a) x++; }", "int f(int a, ) ;",
+	"a = b + c * (d - e) ? f : g", "x->y[3](1,2) << 2 == 4 && !z", "(int*)x + 3",
+	"{ int a = 3, b; for(;;) a--; do x; while(y); }", "const int * const", "-(+!x)*~&y",
+	"{ { a; } { } b; }", "{ a; ", "((a)", "x +", "3 + (", ")", "a ? b", "a += b <<= 2;",
+	"struct s { int a; char *b; } x;", "while (a) { if (b) break; else continue; }",
+	"-\"abc", "x = \"abc;", "x = 'ab';", "f(a, \"b) + c;", "{ a; 'xy'; }", "int f(char c = 'ab');",
+}
+
+// The driver parses the corpus with the interpreted and the generated grammar and prints the differences.
+const driver = `package main
+
+import "github.com/byte-mug/semiparse/parser"
+import "github.com/byte-mug/semiparse/scanlist"
+import "github.com/byte-mug/semiparse/cparse"
+import "strings"
+import "fmt"
+import "os"
+
+func run(p *parser.Parser,rule,src string) (s string) {
+	defer func() { if e := recover(); e!=nil { s = fmt.Sprint("PANIC ",e) } }()
+	sc := new(scanlist.BaseScanner)
+	sc.Init(strings.NewReader(src))
+	sc.Dict,sc.Ops = cparse.CKeywords,cparse.COperators
+	r := p.Match(rule,sc.Next())
+	return fmt.Sprint(r.Result," ",r.Data," ",r.Pos," ",r.Next.SafeTokenText()," ",r.Next.SafePos())
+}
+
+func main() {
+	ip := new(parser.Parser).Construct()
+	cparse.RegisterExpr(ip); cparse.RegisterType(ip); cparse.RegisterExprCast(ip); cparse.RegisterStatememt(ip); cparse.RegisterDeclaration(ip)
+	ip.Freeze()
+	gp := new(parser.Parser).Construct()
+	cparse.RegisterGenerated(gp)
+	gp.Freeze()
+	n,bad := 0,0
+	for _,src := range %#v {
+		for _,rule := range []string{"Declaration","Expr","Statement","Type","Expr0"} {
+			a,b := run(ip,rule,src),run(gp,rule,src)
+			n++
+			if a!=b { bad++; fmt.Printf("%%s %%q:\n\t%%s\n\t%%s\n",rule,src,a,b) }
+		}
+	}
+	fmt.Println("compared",n)
+	if bad>0 { os.Exit(1) }
+}
+`
+
+// Copies the .go files (without tests) of the package directories below src to dst.
+func copyTree(t *testing.T,src,dst string) {
+	err := filepath.Walk(src,func(path string,info os.FileInfo,err error) error {
+		if err!=nil { return err }
+		if info.IsDir() || !strings.HasSuffix(path,".go") || strings.HasSuffix(path,"_test.go") { return nil }
+		rel,_ := filepath.Rel(src,path)
+		data,err := os.ReadFile(path)
+		if err!=nil { return err }
+		if err = os.MkdirAll(filepath.Join(dst,filepath.Dir(rel)),0755); err!=nil { return err }
+		return os.WriteFile(filepath.Join(dst,rel),data,0644)
+	})
+	if err!=nil { t.Fatal(err) }
+}
+
+/*
+Generates code for the cparse grammar into a copy of the module, builds it and
+compares its results with those of the interpreted parser.
+*/
+func TestGenerateCParse(t *testing.T) {
+	if testing.Short() { t.Skip("builds generated code") }
+	if _,err := exec.LookPath("go"); err!=nil { t.Skip("no go tool") }
+	root,err := filepath.Abs("..")
+	if err!=nil { t.Fatal(err) }
+	dir := t.TempDir()
+	for _,d := range []string{"parser","scanlist","cparse"} { copyTree(t,filepath.Join(root,d),filepath.Join(dir,d)) }
+	if err = os.WriteFile(filepath.Join(dir,"go.mod"),[]byte("module github.com/byte-mug/semiparse\n\ngo 1.18\n"),0644); err!=nil { t.Fatal(err) }
+	
+	p := new(parser.Parser).Construct()
+	cparse.RegisterExpr(p); cparse.RegisterType(p); cparse.RegisterExprCast(p); cparse.RegisterStatememt(p); cparse.RegisterDeclaration(p)
+	f,err := os.Create(filepath.Join(dir,"cparse","zz_gen.go"))
+	if err!=nil { t.Fatal(err) }
+	err = Config{Package:"cparse",ImportPath:cparsePath,Register:"RegisterGenerated"}.Generate(f,p)
+	f.Close()
+	if err!=nil { t.Fatal(err) }
+	
+	if err = os.MkdirAll(filepath.Join(dir,"gentest"),0755); err!=nil { t.Fatal(err) }
+	if err = os.WriteFile(filepath.Join(dir,"gentest","main.go"),[]byte(fmt.Sprintf(driver,corpus)),0644); err!=nil { t.Fatal(err) }
+	cmd := exec.Command("go","run","./gentest")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),"GO111MODULE=on","GOFLAGS=","GOWORK=off","GOTOOLCHAIN=local")
+	out,err := cmd.CombinedOutput()
+	if err!=nil { t.Fatalf("%v\n%s",err,out) }
+	if want := fmt.Sprint("compared ",len(corpus)*5,"\n"); string(out)!=want { t.Errorf("got %q, want %q",out,want) }
+}
@@ -0,0 +1,89 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "strings"
+import "fmt"
+
+/*
+Character-class combinators, mainly for scannerless parsing (see
+scanlist.RuneScanner), where every token is a rune. They work on the
+single-character tokens of other scanners as well.
+*/
+
+// Lo..Hi => string
+type Range struct{
+	Lo,Hi rune
+}
+func (r Range) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	t := tokens.SafeToken()
+	if t<r.Lo || t>r.Hi { return ResultFail(fmt.Sprintf("Unexpected %s, expected %s..%s",Textify(t),Textify(r.Lo),Textify(r.Hi)),tokens.SafePos()) }
+	return ResultOk(tokens.Next(),tokens.TokenText)
+}
+
+// Any of the runes => string
+type Set string
+func (s Set) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	t := tokens.SafeToken()
+	if t<0 || !strings.ContainsRune(string(s),t) { return ResultFail(fmt.Sprintf("Unexpected %s, expected one of %q",Textify(t),string(s)),tokens.SafePos()) }
+	return ResultOk(tokens.Next(),tokens.TokenText)
+}
+
+// Any rune, except the given ones (and EOF) => string
+type NotSet string
+func (s NotSet) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	t := tokens.SafeToken()
+	if tokens==nil || strings.ContainsRune(string(s),t) { return ResultFail(fmt.Sprintf("Unexpected %s",Textify(t)),tokens.SafePos()) }
+	return ResultOk(tokens.Next(),tokens.TokenText)
+}
+
+// The runes of the string, one token each => string
+type Literal string
+func (l Literal) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	t := tokens
+	for _,c := range string(l) {
+		if t.SafeToken()!=c { return ResultFail(fmt.Sprintf("Unexpected %s, expected %q",Textify(t.SafeToken()),string(l)),t.SafePos()) }
+		t = t.Next()
+	}
+	return ResultOk(t,string(l))
+}
+
+// Inner => the concatenated text of the tokens, Inner has matched.
+type Capture struct{
+	Inner ParseRule
+}
+func (c Capture) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	res := c.Inner.Parse(p,tokens,left)
+	if res.Result==RESULT_OK { res.Data = TextBetween(tokens,res.Next) }
+	return res
+}
+
+// Returns the concatenated text of the tokens from start up to (excluding) end.
+func TextBetween(start,end *scanlist.Element) string {
+	var b strings.Builder
+	for t := start; t!=nil && t!=end; t = t.Next() { b.WriteString(t.TokenText) }
+	return b.String()
+}
@@ -0,0 +1,52 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "strings"
+import "fmt"
+import "testing"
+
+// Scannerless parsing on the runes of the input.
+func TestChars(t *testing.T) {
+	p := new(Parser).Construct()
+	p.Define("Ident",false,Capture{ArrayPlus{Range{'a','z'}}})
+	p.Define("Str",false,Capture{ArraySeq{Set(`"'`),ArrayStar{NotSet(`"'`)},Set(`"'`)}})
+	p.Define("Subst",false,ArraySeq{Literal("${"),Delegate("Ident"),Literal("}")})
+	for _,c := range []struct{ rule,src,want string }{
+		{"Ident","abc1","0 abc 1"},
+		{"Ident","1","1 Unexpected '1', expected 'a'..'z' 1:1"},
+		{"Str",`"ä€ x" y`,`0 "ä€ x"  `},
+		{"Str",`"ab`,"1 Unexpected <<EOF>>, expected one of \"\\\"'\" 0:0"},
+		{"Subst","${name}!","0 [${ name }] !"},
+		{"Subst","${né}","1 Unexpected 'é', expected \"}\" 1:4"},
+		{"Subst","$(x)","1 Unexpected '(', expected \"${\" 1:2"},
+	} {
+		r := p.Match(c.rule,scanlist.Runes(strings.NewReader(c.src)))
+		got := fmt.Sprint(r.Result," ",r.Data," ",r.Next.SafeTokenText())
+		if !r.Ok() { got = fmt.Sprint(r.Result," ",r.Data," ",r.Pos.Line,":",r.Pos.Column) }
+		if got!=c.want { t.Errorf("%s %q: got %q, want %q",c.rule,c.src,got,c.want) }
+	}
+}
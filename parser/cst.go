@@ -0,0 +1,142 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "text/scanner"
+import "github.com/byte-mug/semiparse/scanlist"
+
+/*
+A node of the concrete syntax tree. There is one node for each successful
+rule invocation (Match() or MatchNoLeftRecursion()).
+*/
+type Node struct{
+	Name string // The rule name.
+	Start *scanlist.Element // The first token.
+	End *scanlist.Element // The first token after the node; nil at EOF.
+	Pos scanner.Position
+	Children []*Node
+	Data interface{} // The result of the rule.
+}
+
+// Returns the tokens, covered by n.
+func (n *Node) Tokens() (toks []*scanlist.Element) {
+	for t := n.Start; t!=nil && t!=n.End; t = t.Next() { toks = append(toks,t) }
+	return
+}
+
+/*
+The indices of the tokens from a node's start up to and including its end
+(nil at EOF). Tokens beyond the end have the maximum index.
+*/
+type tokenIndex map[*scanlist.Element]int
+
+func indexTokens(start,end *scanlist.Element) tokenIndex {
+	x := make(tokenIndex)
+	for i,t := 0,start; ; i,t = i+1,t.Next() {
+		x[t] = i
+		if t==end || t==nil { break }
+	}
+	return x
+}
+func (x tokenIndex) of(e *scanlist.Element) int {
+	if i,ok := x[e]; ok { return i }
+	return int(^uint(0)>>1)
+}
+
+/*
+Removes nodes from attempts, that have been abandoned within a Pfunc: the
+combinators drop such nodes themselves, but a Pfunc can't. The last attempt
+wins, so nodes are dropped, if they overlap with a later node. Overlaps are
+detected by the order of the tokens between start and end (the span of the
+parent), as offsets aren't monotonic (includes, macro expansions, synthetic
+lists).
+*/
+func cstFilter(ch []*Node,start,end *scanlist.Element) []*Node {
+	var x tokenIndex
+	var next *Node // The last node, that has been kept.
+	j := len(ch)
+	for i := len(ch)-1; i>=0; i-- {
+		c := ch[i]
+		keep := next==nil || c.End==next.Start
+		if !keep {
+			if x==nil { x = indexTokens(start,end) }
+			keep = x.of(c.End)<=x.of(next.Start)
+		}
+		if keep {
+			j--
+			ch[j] = c
+			next = c
+		}
+	}
+	return ch[j:]
+}
+
+func (p *Parser) cstEnter() {
+	p.cstStack = append(p.cstStack,nil)
+}
+// Finishes the node of rp and returns the nodes, it contributes to its parent.
+func (p *Parser) cstLeave(rp *ruleParser,tokens *scanlist.Element,res ParserResult) []*Node {
+	i := len(p.cstStack)-1
+	ch := p.cstStack[i]
+	p.cstStack[i] = nil
+	p.cstStack = p.cstStack[:i]
+	if res.Result!=RESULT_OK { return nil }
+	ch = cstFilter(ch,tokens,res.Next)
+	if i==0 {
+		p.cst = &Node{rp.name,tokens,res.Next,tokens.SafePos(),ch,res.Data}
+		return []*Node{p.cst}
+	}
+	nodes := ch
+	if rp.opts==nil || !rp.opts.Hidden { nodes = []*Node{{rp.name,tokens,res.Next,tokens.SafePos(),ch,res.Data}} }
+	p.cstAdd(nodes)
+	return nodes
+}
+
+// Adds nodes to the current node.
+func (p *Parser) cstAdd(nodes []*Node) {
+	i := len(p.cstStack)-1
+	if i<0 {
+		if len(nodes)==1 { p.cst = nodes[0] }
+		return
+	}
+	p.cstStack[i] = append(p.cstStack[i],nodes...)
+}
+
+// Returns a mark, that can be passed to cstReset() to drop all nodes, added after it.
+func (p *Parser) cstMark() int {
+	if p==nil || len(p.cstStack)==0 { return 0 }
+	return len(p.cstStack[len(p.cstStack)-1])
+}
+func (p *Parser) cstReset(m int) {
+	if p==nil || len(p.cstStack)==0 { return }
+	i := len(p.cstStack)-1
+	p.cstStack[i] = p.cstStack[i][:m]
+}
+
+/*
+Returns the concrete syntax tree of the last (outermost) Match() or
+MatchNoLeftRecursion() call, if BuildCST is set and that call succeeded.
+*/
+func (p *Parser) CST() *Node { return p.cst }
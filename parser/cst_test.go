@@ -0,0 +1,56 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "testing"
+
+func names(ns []*Node) (r []string) {
+	for _,n := range ns { r = append(r,n.Name) }
+	return
+}
+
+// Offsets, that aren't monotonic (like in included files), must not drop nodes.
+func TestCSTUnorderedOffsets(t *testing.T) {
+	p := new(Parser).Construct()
+	p.Define("Id",false,Required{scanner.Ident,nil})
+	p.Define("Pair",false,ArraySeq{Delegate("Id"),Required{',',nil},Delegate("Id")})
+	// Looks at an Id first, but abandons it.
+	p.Define("Top",false,Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+		p.Match("Id",tokens)
+		return p.Match("Pair",tokens)
+	}))
+	p.BuildCST = true
+	l := scanlist.FromTokens([]scanlist.Token{
+		{Token:scanner.Ident,Text:"x",Pos:scanner.Position{Offset:20,Line:3,Column:1}},
+		{Text:",",Pos:scanner.Position{Offset:21,Line:3,Column:2}},
+		{Token:scanner.Ident,Text:"y",Pos:scanner.Position{Offset:0,Line:1,Column:1}},
+	})
+	if r := p.Match("Top",l); !r.Ok() { t.Fatal(r.Data) }
+	top := p.CST()
+	if got := names(top.Children); len(got)!=1 || got[0]!="Pair" { t.Fatalf("children of Top: %v",got) }
+	if got := names(top.Children[0].Children); len(got)!=2 { t.Fatalf("children of Pair: %v",got) }
+}
@@ -0,0 +1,217 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "text/scanner"
+import "github.com/byte-mug/semiparse/scanlist"
+import "io"
+import "bytes"
+import "unicode/utf8"
+
+/*
+A source text, that is parsed with the rule Rule and reparsed incrementally
+after edits (see Edit()):
+
+	doc := &parser.Document{Parser:p,Rule:"Expr",Scan:func(src io.Reader,base scanner.Position) *scanlist.Element {
+		s := new(scanlist.BaseScanner)
+		s.Init(src)
+		s.Base = base
+		return s.Next()
+	}}
+	doc.SetText([]byte("a+b*c"))
+	res := doc.Edit(2,1,"(b+d)")
+
+Memoized results (see RuleOptions.Memoize) are kept between the parses. After
+an edit, the tokens before the edit are reused (the list is cut behind them,
+so earlier results must not be used anymore), as well as the results of all
+memoized rules, that have only looked at these tokens. Behind the edit, the
+old tokens are reused, once the rescanned ones match them again, along with
+the results of the rules, that have only looked at those, if their Data can
+be moved (see PosShift.Data()). Rules, that change the parse state (see
+State()), should not be memoized, because their side effects are skipped,
+when their result is reused.
+*/
+type Document struct{
+	Parser *Parser
+	Rule string
+	
+	// Tokenizes src. The first character of src is at the position base.
+	Scan func(src io.Reader,base scanner.Position) *scanlist.Element
+	
+	// If set, the results of all rules are memoized.
+	MemoizeAll bool
+	
+	Text []byte
+	Tokens *scanlist.Element
+	Result ParserResult
+	
+	memo map[memoKey]memoEntry
+	tracker scanlist.Tracker
+}
+
+// Replaces the text of the document and parses it from scratch.
+func (d *Document) SetText(text []byte) ParserResult {
+	d.Text = text
+	d.memo = nil
+	d.Tokens = d.tracker.Track(d.Scan(bytes.NewReader(text),scanner.Position{Line:1,Column:1}))
+	return d.parse()
+}
+
+/*
+Replaces length bytes at offset with text and reparses the document. The
+result is the same as SetText() with the edited text would return.
+*/
+func (d *Document) Edit(offset, length int, text string) ParserResult {
+	if offset<0 || length<0 || offset+length>len(d.Text) { panic("edit out of range") }
+	nt := make([]byte,0,len(d.Text)-length+len(text))
+	nt = append(append(append(nt,d.Text[:offset]...),text...),d.Text[offset+length:]...)
+	
+	// The tokens before the edit, except the last one (the scanner might
+	// have looked at the next character), are kept.
+	var keep []*scanlist.Element
+	for t := d.Tokens; t!=nil && scanlist.EndOffset(t)<offset; t = t.Next() { keep = append(keep,t) }
+	if len(keep)>0 { keep = keep[:len(keep)-1] }
+	start := 0
+	if len(keep)>0 { start = scanlist.EndOffset(keep[len(keep)-1]) }
+	
+	sh := PosShift{From:textPos(d.Text,offset+length),To:textPos(nt,offset+len(text))}
+	rest := d.Scan(bytes.NewReader(nt[start:]),textPos(nt,start))
+	d.Text = nt
+	var e,old *scanlist.Element
+	if len(keep)>0 { e = keep[len(keep)-1]; old = e.Next() } else { old = d.Tokens }
+	head,reused,limit := d.tracker.Resync(e,old,rest,sh.To.Offset,sh.To.Offset-sh.From.Offset)
+	if e==nil { d.Tokens = head }
+	
+	// Drop the memoized results, that depend on the replaced tokens, and
+	// shift the ones, that only depend on reused tokens behind the edit.
+	moved := make(map[*scanlist.Element]bool,len(reused))
+	for _,t := range reused { moved[t] = true }
+	for k,m := range d.memo {
+		switch {
+		case moved[k.tokens] && m.extent<=limit:
+			if n,ok := m.shifted(sh); ok { d.memo[k] = n } else { delete(d.memo,k) }
+		case m.extent>start:
+			delete(d.memo,k)
+		}
+	}
+	return d.parse()
+}
+
+func (d *Document) parse() ParserResult {
+	p := d.Parser
+	omemo,oall,otr := p.memo,p.memoAll,p.tracker
+	defer func() { p.memo,p.memoAll,p.tracker = omemo,oall,otr }()
+	p.memo,p.memoAll,p.tracker = d.memo,d.MemoizeAll,&d.tracker
+	p.extents = nil
+	d.tracker.Max = 0
+	d.Result = p.Match(d.Rule,d.Tokens)
+	d.memo = p.memo
+	return d.Result
+}
+
+// Returns the position of the offset o within text.
+func textPos(text []byte,o int) scanner.Position {
+	l := bytes.LastIndexByte(text[:o],'\n')+1
+	return scanner.Position{
+		Offset: o,
+		Line: bytes.Count(text[:l],[]byte{'\n'})+1,
+		Column: utf8.RuneCount(text[l:o])+1,
+	}
+}
+
+/*
+An edit, as seen by the positions behind it: From (the end of the replaced
+text in the old text) moves to To (its end in the new text).
+*/
+type PosShift struct{
+	From,To scanner.Position
+}
+
+// Returns p, moved by the edit, if it is behind it.
+func (s PosShift) Pos(p scanner.Position) scanner.Position {
+	if !p.IsValid() || p.Offset<s.From.Offset { return p }
+	if p.Line==s.From.Line { p.Column += s.To.Column-s.From.Column }
+	p.Line += s.To.Line-s.From.Line
+	p.Offset += s.To.Offset-s.From.Offset
+	return p
+}
+
+/*
+Implemented by result Data, that contains positions, so a Document can reuse
+it behind an edit. ShiftPos returns a copy, whose positions are passed
+through s.Pos(), or false, if it can't. The receiver must not be modified, as
+earlier results may share it.
+*/
+type PosShifter interface{
+	ShiftPos(s PosShift) (interface{},bool)
+}
+
+/*
+Returns a copy of the result Data v, moved by the edit, or false, if v can't
+be moved. That is, unless v is nil, a string, a number, a bool, a token, a
+PosShifter or a []interface{} of these.
+*/
+func (s PosShift) Data(v interface{}) (interface{},bool) {
+	switch v := v.(type) {
+	case nil,string,bool,int,int64,uint,uint64,float64,rune,*scanlist.Element: return v,true
+	case PosShifter: return v.ShiftPos(s)
+	case []interface{}:
+		if v==nil { return v,true }
+		c := make([]interface{},len(v))
+		for i,e := range v {
+			var ok bool
+			if c[i],ok = s.Data(e); !ok { return nil,false }
+		}
+		return c,true
+	}
+	return nil,false
+}
+
+// Like Data(), but for CST nodes.
+func (s PosShift) nodes(ns []*Node) ([]*Node,bool) {
+	c := make([]*Node,len(ns))
+	for i,n := range ns {
+		d,ok := s.Data(n.Data)
+		if !ok { return nil,false }
+		m := &Node{Name:n.Name,Start:n.Start,End:n.End,Pos:s.Pos(n.Pos),Data:d}
+		if n.Children!=nil {
+			if m.Children,ok = s.nodes(n.Children); !ok { return nil,false }
+		}
+		c[i] = m
+	}
+	return c,true
+}
+
+// Returns a copy of m, moved by the edit s, if its result can be moved.
+func (m memoEntry) shifted(s PosShift) (memoEntry,bool) {
+	d,ok := s.Data(m.res.Data)
+	if !ok { return m,false }
+	m.res.Data,m.res.Pos = d,s.Pos(m.res.Pos)
+	if m.nodes!=nil {
+		if m.nodes,ok = s.nodes(m.nodes); !ok { return m,false }
+	}
+	if m.extent!=scanlist.EOF { m.extent += s.To.Offset-s.From.Offset }
+	return m,true
+}
@@ -0,0 +1,166 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "reflect"
+import "strings"
+import "io"
+import "testing"
+
+type docAtom struct{
+	Text string
+	Pos scanner.Position
+}
+type docSum struct{
+	Terms []interface{}
+	Pos scanner.Position
+}
+func (a docAtom) ShiftPos(s PosShift) (interface{},bool) {
+	a.Pos = s.Pos(a.Pos)
+	return a,true
+}
+func (d *docSum) ShiftPos(s PosShift) (interface{},bool) {
+	t,ok := s.Data(d.Terms)
+	if !ok { return nil,false }
+	return &docSum{t.([]interface{}),s.Pos(d.Pos)},true
+}
+
+func docScan(src io.Reader,base scanner.Position) *scanlist.Element {
+	s := new(scanlist.BaseScanner)
+	s.Init(src)
+	s.Base = base
+	return s.Next()
+}
+
+func docParser(calls *int) *Parser {
+	p := new(Parser).Construct()
+	p.Define("Atom",false,Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+		*calls++
+		switch tokens.SafeToken() {
+		case scanner.Ident,scanner.Int: return ResultOk(tokens.Next(),docAtom{tokens.TokenText,tokens.Pos})
+		}
+		return ResultFail("Expected atom",tokens.SafePos())
+	}))
+	p.Define("Sum",false,Action{ArraySeq{Delegate("Atom"),ArrayStar{ArraySeq{Required{'+',nil},Delegate("Atom")}}},
+		func(res ParserResult,tokens *scanlist.Element, left interface{}) ParserResult {
+			if !res.Ok() { return res }
+			i := res.Data.([]interface{})
+			s := &docSum{[]interface{}{i[0]},tokens.Pos}
+			for _,t := range i[1].([]interface{}) { s.Terms = append(s.Terms,t.([]interface{})[1]) }
+			res.Data = s
+			return res
+		}})
+	p.Define("Stmt",false,ArraySeq{Delegate("Sum"),Required{';',nil}})
+	p.Define("Body",false,ArrayStar{Delegate("Stmt")})
+	return p
+}
+
+func docCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		c := make([]interface{},len(v))
+		for i,e := range v { c[i] = docCopy(e) }
+		return c
+	case *docSum: return &docSum{docCopy(v.Terms).([]interface{}),v.Pos}
+	}
+	return v
+}
+
+func docTokens(e *scanlist.Element) (r []scanlist.Element) {
+	for ; e!=nil; e = e.Next() { r = append(r,scanlist.Element{Token:e.Token,TokenText:e.TokenText,Pos:e.Pos,Start:e.Start}) }
+	return
+}
+
+// Every edit must give the same result as parsing the edited text from scratch.
+func TestDocumentEdit(t *testing.T) {
+	var calls int
+	p := docParser(&calls)
+	doc := &Document{Parser:p,Rule:"Body",Scan:docScan,MemoizeAll:true}
+	doc.SetText([]byte("a + b;\nc + 1 + d;\n  e;\nf + g;\n"))
+	for _,c := range []struct{
+		offset,length int
+		text string
+	}{
+		{0,0,"x + "},
+		{0,0,"\n\n"},
+		{6,1,"bb"},
+		{4,4,""},
+		{10,0,"+ h"},
+		{10,3,""},
+		{15,0," q;\n"},
+		{5,0,"/* a\ncomment */"},
+		{5,15,""},
+		{2,0,";"},
+		{2,1,""},
+		{0,0,"1;"},
+	}{
+		if c.offset+c.length>len(doc.Text) { t.Fatalf("edit %v out of range of %q",c,doc.Text) }
+		res := doc.Edit(c.offset,c.length,c.text)
+		full := &Document{Parser:p,Rule:"Body",Scan:docScan}
+		want := full.SetText(doc.Text)
+		if res.Result!=want.Result || res.Pos!=want.Pos || !reflect.DeepEqual(res.Data,want.Data) || !reflect.DeepEqual(docTokens(res.Next),docTokens(want.Next)) {
+			t.Errorf("%q: got %v, want %v",doc.Text,res,want)
+		}
+		if got := docTokens(doc.Tokens); !reflect.DeepEqual(got,docTokens(full.Tokens)) { t.Errorf("%q: tokens %v",doc.Text,got) }
+	}
+}
+
+// The results behind an edit are reused, without changing the earlier results.
+func TestDocumentReuse(t *testing.T) {
+	var calls int
+	p := docParser(&calls)
+	doc := &Document{Parser:p,Rule:"Body",Scan:docScan,MemoizeAll:true}
+	first := doc.SetText([]byte(strings.Repeat("a + b;\n",100)))
+	before := docCopy(first.Data)
+	calls = 0
+	if res := doc.Edit(0,0,"x + y;\n"); !res.Ok() || len(res.Data.([]interface{}))!=101 { t.Fatal(res.Data) }
+	if calls>5 { t.Errorf("%d atoms parsed",calls) }
+	if !reflect.DeepEqual(first.Data,before) { t.Errorf("the edit changed the earlier result") }
+}
+
+type docPlain struct{
+	Pos scanner.Position
+}
+
+// Data, that isn't a PosShifter, is parsed again.
+func TestDocumentNoShift(t *testing.T) {
+	calls := 0
+	p := new(Parser).Construct()
+	p.Define("Atom",false,Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+		calls++
+		if tokens.SafeToken()!=scanner.Ident { return ResultFail("Expected atom",tokens.SafePos()) }
+		return ResultOk(tokens.Next(),&docPlain{tokens.Pos})
+	}))
+	p.Define("Body",false,ArrayStar{Delegate("Atom")})
+	doc := &Document{Parser:p,Rule:"Body",Scan:docScan,MemoizeAll:true}
+	doc.SetText([]byte("a b c"))
+	calls = 0
+	res := doc.Edit(0,0,"x ")
+	want := (&Document{Parser:p,Rule:"Body",Scan:docScan}).SetText(doc.Text)
+	if !reflect.DeepEqual(res.Data,want.Data) { t.Errorf("got %v, want %v",res.Data,want.Data) }
+	if calls<4 { t.Errorf("%d atoms parsed",calls) }
+}
@@ -0,0 +1,297 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "fmt"
+
+/*
+The iterative engine. Instead of calling the Parse() methods of the
+combinators, which recurse on the goroutine stack, it interprets them using
+an explicit, heap-allocated stack of frames. Delegates are resolved within
+the same engine, so the nesting depth of grammars built from the combinators
+is bounded by memory only.
+
+Opaque rules, like Pfunc or Rule[T], are called as usual; when they call
+p.Match() again, that match starts a new engine on the goroutine stack.
+*/
+
+type frame struct{
+	rule ParseRule
+	tokens *scanlist.Element
+	left interface{}
+	state int
+	i int
+	fail bool
+	opr ParserResult
+	arr []interface{}
+	mark int // see Parser.cstMark()
+	
+	q *Parser // the module view, see Parser.In()
+	
+	// For rule invocations.
+	rp *ruleParser
+	phaseTwo bool
+}
+
+type engine struct{
+	p *Parser
+	stack []frame
+	ret ParserResult
+}
+
+func (e *engine) call(r ParseRule,tokens *scanlist.Element, left interface{}) {
+	q := e.stack[len(e.stack)-1].q
+	e.stack = append(e.stack,frame{rule:r,tokens:tokens,left:left,q:q})
+}
+// Replaces the frame f with an invocation of the rule n.
+func (e *engine) becomeRule(f *frame,n string,phaseTwo bool) {
+	rp := f.q.rule(n,false)
+	if rp==nil { panic("rule not defined") }
+	q := f.q
+	if rp.ns!=q.ns { q = q.In(rp.ns) }
+	*f = frame{tokens:f.tokens,rp:rp,phaseTwo:phaseTwo,q:q}
+}
+func (e *engine) result(r ParserResult) {
+	e.ret = r
+	e.stack[len(e.stack)-1] = frame{}
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+func (p *Parser) runEngine(rp *ruleParser,phaseTwo bool,tokens *scanlist.Element) ParserResult {
+	e := &engine{p:p,stack:make([]frame,1,64)}
+	e.stack[0] = frame{tokens:tokens,rp:rp,phaseTwo:phaseTwo,q:p}
+	for len(e.stack)>0 { e.step() }
+	return e.ret
+}
+
+// Performs one step of the frame on top of the stack.
+func (e *engine) step() {
+	f := &e.stack[len(e.stack)-1]
+	if f.rp!=nil { e.stepRule(f); return }
+	
+	switch v := f.rule.(type) {
+	case Delegate:
+		e.becomeRule(f,string(v),true)
+	case DelegateNoLeftRecursion:
+		e.becomeRule(f,string(v),false)
+	case *ParamDelegate:
+		e.becomeRule(f,"."+v.Instance(f.q),true)
+	case First:
+		f.rule = v.Inner
+	case Switch:
+		if r,ok := v.Cases[f.tokens.SafeToken()]; ok {
+			f.rule = r
+		} else if v.Default!=nil {
+			f.rule = v.Default
+		} else {
+			e.result(ResultFail("no rules!",f.tokens.SafePos()))
+		}
+	case Action:
+		if f.state==0 {
+			f.state = 1
+			e.call(v.Inner,f.tokens,f.left)
+			return
+		}
+		e.result(v.F(e.ret,f.tokens,f.left))
+	case OR:
+		if f.state==1 {
+			switch e.ret.Result {
+			case RESULT_OK,RESULT_FAILED_CUT:
+				e.result(e.ret)
+				return
+			}
+			e.p.cstReset(f.mark)
+			f.opr = e.ret
+			f.fail = true
+			f.i++
+		}
+		if f.i<len(v) {
+			f.state = 1
+			f.mark = e.p.cstMark()
+			e.call(v[f.i],f.tokens,f.left)
+			return
+		}
+		if f.fail { e.result(f.opr) ; return }
+		e.result(ResultFail("no rules!",f.tokens.SafePos()))
+	case LSeq:
+		if f.state==0 {
+			f.state = 1
+			f.opr = ResultOk(f.tokens,f.left)
+		} else {
+			f.opr = e.ret
+		}
+		if f.opr.Result!=RESULT_OK || f.i>=len(v) { e.result(f.opr) ; return }
+		f.i++
+		e.call(v[f.i-1],f.opr.Next,f.opr.Data)
+	case ArraySeq:
+		if f.state==0 {
+			f.state = 1
+			f.arr = make([]interface{},len(v))
+		} else {
+			if e.ret.Result!=RESULT_OK { e.result(e.ret) ; return }
+			f.tokens = e.ret.Next
+			f.arr[f.i] = e.ret.Data
+			f.i++
+			f.opr = e.ret
+		}
+		if f.i<len(v) {
+			e.call(v[f.i],f.tokens,f.left)
+			return
+		}
+		opr := f.opr
+		opr.Data = f.arr
+		e.result(opr)
+	case LStar,LPlus:
+		var inner ParseRule
+		if s,ok := v.(LStar); ok {
+			inner = s.Inner
+			if f.state==0 { f.state = 2; f.opr = ResultOk(f.tokens,f.left) }
+		} else {
+			inner = v.(LPlus).Inner
+		}
+		switch f.state {
+		case 0: // LPlus: first element
+			f.state = 1
+			e.call(inner,f.tokens,f.left)
+			return
+		case 1:
+			if e.ret.Result!=RESULT_OK { e.result(e.ret) ; return }
+			f.opr = e.ret
+			f.tokens = e.ret.Next
+			f.state = 3
+		case 3:
+			switch e.ret.Result {
+			case RESULT_FAILED:
+				e.p.cstReset(f.mark)
+				e.result(f.opr)
+				return
+			case RESULT_FAILED_CUT: e.result(e.ret) ; return
+			}
+			f.opr = e.ret
+			f.left = e.ret.Data
+			f.tokens = e.ret.Next
+		case 2:
+			f.state = 3
+		}
+		f.mark = e.p.cstMark()
+		e.call(inner,f.tokens,f.left)
+	case ArrayStar,ArrayPlus:
+		var inner ParseRule
+		if s,ok := v.(ArrayStar); ok {
+			inner = s.Inner
+			if f.state==0 { f.state = 2; f.arr = []interface{}{} }
+		} else {
+			inner = v.(ArrayPlus).Inner
+		}
+		switch f.state {
+		case 0: // ArrayPlus: first element
+			f.state = 1
+			e.call(inner,f.tokens,nil)
+			return
+		case 1:
+			if e.ret.Result!=RESULT_OK { e.result(e.ret) ; return }
+			f.arr = []interface{}{e.ret.Data}
+			f.tokens = e.ret.Next
+			f.state = 3
+		case 3:
+			switch e.ret.Result {
+			case RESULT_FAILED:
+				e.p.cstReset(f.mark)
+				e.result(ResultOk(f.tokens,f.arr))
+				return
+			case RESULT_FAILED_CUT: e.result(e.ret) ; return
+			}
+			f.arr = append(f.arr,e.ret.Data)
+			f.tokens = e.ret.Next
+		case 2:
+			f.state = 3
+		}
+		f.mark = e.p.cstMark()
+		e.call(inner,f.tokens,nil)
+	case TokenFinishedOptional:
+		if f.state==0 {
+			if f.tokens.SafeToken()==v.Token { e.result(ResultOk(f.tokens.Next(),nil)) ; return }
+			f.state = 1
+			e.call(v.Inner,f.tokens,f.left)
+			return
+		}
+		ir := e.ret
+		if ir.Result!=RESULT_OK { e.result(ir) ; return }
+		err,t := Match(Textify,ir.Next,v.Token)
+		if err!=nil { e.result(ResultFail(fmt.Sprint(err),ir.Next.SafePos())) ; return }
+		ir.Next = t
+		e.result(ir)
+	default:
+		e.result(f.rule.Parse(f.q,f.tokens,f.left))
+	}
+}
+
+// Like e.result(), but finishes a rule invocation.
+func (e *engine) ruleResult(f *frame,r ParserResult) {
+	var nodes []*Node
+	r = LexicalError(f.tokens,r)
+	if e.p.BuildCST { nodes = e.p.cstLeave(f.rp,f.tokens,r) }
+	if e.p.hooked(f.rp) { r = e.p.ruleExit(f.rp,f.phaseTwo,f.tokens,r,nodes) }
+	e.result(r)
+}
+
+// A rule invocation, like matchLowLevel.
+func (e *engine) stepRule(f *frame) {
+	rp := f.rp
+	switch f.state {
+	case 0:
+		if e.p.hooked(rp) {
+			if r,ok := e.p.ruleEnter(rp,f.phaseTwo,f.tokens); ok { e.result(r) ; return }
+		}
+		if e.p.BuildCST { e.p.cstEnter() }
+		f.state = 1
+		if rp.jump1!=nil {
+			e.call(rp.jump1.get(f.tokens.SafeToken()),f.tokens,nil)
+		} else {
+			e.call(rp.phase1,f.tokens,nil)
+		}
+		return
+	case 1:
+		if e.ret.Result!=RESULT_OK || !f.phaseTwo { e.ruleResult(f,e.ret) ; return }
+		f.opr = ResultOk(e.ret.Next,e.ret.Data)
+		f.state = 2
+	case 2:
+		switch e.ret.Result {
+		case RESULT_FAILED:
+			e.p.cstReset(f.mark)
+			e.ruleResult(f,f.opr)
+			return
+		case RESULT_FAILED_CUT: e.ruleResult(f,e.ret) ; return
+		}
+		f.opr = e.ret
+	}
+	f.mark = e.p.cstMark()
+	if rp.jump2!=nil {
+		e.call(rp.jump2.get(f.opr.Next.SafeToken()),f.opr.Next,f.opr.Data)
+	} else {
+		e.call(rp.phase2,f.opr.Next,f.opr.Data)
+	}
+}
@@ -0,0 +1,217 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+
+/*
+Declares the FIRST set of Inner, that is not computable otherwise (as with
+Pfunc). Inner may only succeed or return RESULT_FAILED_CUT, if the first
+token is in Tokens or in the FIRST set of As. For all other tokens, Inner must
+return RESULT_FAILED.
+*/
+type First struct{
+	Inner ParseRule
+	Tokens []rune
+	As ParseRule // optional
+}
+func (f First) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	return f.Inner.Parse(p,tokens,left)
+}
+
+// Declares the FIRST set of pf. See First.
+func (pf Pfunc) First(tokens ...rune) ParseRule {
+	return First{pf,tokens,nil}
+}
+
+// Declares the FIRST set of pf to be the FIRST set of r. See First.
+func (pf Pfunc) FirstAs(r ParseRule) ParseRule {
+	return First{pf,nil,r}
+}
+
+// A FIRST set. If any is set, the rule may match any token (or nothing).
+type firstSet struct{
+	any bool
+	toks map[rune]bool
+}
+func (f *firstSet) add(t rune) {
+	if f.toks==nil { f.toks = make(map[rune]bool) }
+	f.toks[t] = true
+}
+func (f *firstSet) union(o firstSet) {
+	if o.any { f.any = true }
+	for t := range o.toks { f.add(t) }
+}
+
+type firstCalc struct{
+	p *Parser // the module view of the current rule
+	rules map[string]*firstSet
+}
+
+// Returns the FIRST set of r and whether r can match the empty input.
+func (c *firstCalc) first(r ParseRule) (fs firstSet,nullable bool) {
+	switch v := r.(type) {
+	case Required:
+		fs.add(v.Token)
+	case Range:
+		if v.Hi-v.Lo>=256 { fs.any = true; break }
+		for t := v.Lo; t<=v.Hi; t++ { fs.add(t) }
+	case Set:
+		for _,t := range v { fs.add(t) }
+	case Literal:
+		if v=="" { return fs,true }
+		for _,t := range v { fs.add(t); break }
+	case Capture:
+		return c.first(v.Inner)
+	case First:
+		for _,t := range v.Tokens { fs.add(t) }
+		if v.As!=nil {
+			o,_ := c.first(v.As)
+			fs.union(o)
+		}
+	case TokenFinishedOptional:
+		fs,_ = c.first(v.Inner)
+		fs.add(v.Token)
+	case OR:
+		for _,a := range v {
+			o,n := c.first(a)
+			fs.union(o)
+			nullable = nullable||n
+		}
+	case LSeq:
+		return c.firstSeq(v)
+	case ArraySeq:
+		return c.firstSeq(v)
+	case LStar:
+		fs,_ = c.first(v.Inner)
+		nullable = true
+	case ArrayStar:
+		fs,_ = c.first(v.Inner)
+		nullable = true
+	case LPlus:
+		return c.first(v.Inner)
+	case ArrayPlus:
+		return c.first(v.Inner)
+	case Delegate:
+		return c.rule(string(v)),false
+	case DelegateNoLeftRecursion:
+		return c.rule(string(v)),false
+	case *ParamDelegate:
+		return c.rule("."+v.Instance(c.p)),false
+	case Action:
+		return c.first(v.Inner)
+	case Switch:
+		for t := range v.Cases { fs.add(t) }
+		if v.Default!=nil {
+			o,n := c.first(v.Default)
+			fs.union(o)
+			nullable = n
+		}
+	default:
+		fs.any = true
+	}
+	return
+}
+func (c *firstCalc) firstSeq(s []ParseRule) (fs firstSet,nullable bool) {
+	for _,r := range s {
+		o,n := c.first(r)
+		fs.union(o)
+		if !n { return fs,false }
+	}
+	return fs,true
+}
+func (c *firstCalc) rule(n string) firstSet {
+	n = c.p.Resolve(n)
+	if fs,ok := c.rules[n]; ok { return *fs }
+	rp,ok := c.p.rules[n]
+	if !ok { return firstSet{any:true} }
+	
+	// Guards against (indirect) left recursion.
+	c.rules[n] = &firstSet{any:true}
+	outer := c.p
+	c.p = c.p.In(rp.ns)
+	fs,nullable := c.first(rp.phase1)
+	c.p = outer
+	if nullable { fs.any = true }
+	c.rules[n] = &fs
+	return fs
+}
+
+// A token->alternatives jump table for an OR.
+type dispatch struct{
+	byToken map[rune]OR
+	other OR // Alternatives for all other tokens.
+}
+func (d *dispatch) get(t rune) OR {
+	if o,ok := d.byToken[t]; ok { return o }
+	return d.other
+}
+
+/*
+Builds a jump table for o. If keepLast is set, the last alternative is
+tried on every token, so that the OR fails with the same result.
+*/
+func (c *firstCalc) dispatch(o OR,keepLast bool) *dispatch {
+	d := &dispatch{byToken:make(map[rune]OR)}
+	sets := make([]firstSet,len(o))
+	for i,a := range o {
+		fs,nullable := c.first(a)
+		if nullable { fs.any = true }
+		sets[i] = fs
+		for t := range fs.toks { d.byToken[t] = nil }
+	}
+	for t := range d.byToken {
+		var alts OR
+		for i,a := range o {
+			if sets[i].any || sets[i].toks[t] || (keepLast && i==len(o)-1) { alts = append(alts,a) }
+		}
+		d.byToken[t] = alts
+	}
+	for i,a := range o {
+		if sets[i].any || (keepLast && i==len(o)-1) { d.other = append(d.other,a) }
+	}
+	return d
+}
+
+/*
+Freezes the grammar. After this call, no more rules can be defined. Freeze
+computes the FIRST sets of all alternatives and builds a token->alternatives
+jump table for every rule, so that alternatives, that can't match the next
+token are skipped. The results are exactly the same as without a jump table.
+*/
+func (p *Parser) Freeze() {
+	if p.frozen { return }
+	p.InstantiateAll()
+	c := &firstCalc{p,make(map[string]*firstSet)}
+	for _,rp := range p.rules {
+		c.p = p.In(rp.ns)
+		rp.jump1 = c.dispatch(rp.phase1,true)
+		rp.jump2 = c.dispatch(rp.phase2,false)
+	}
+	p.frozen = true
+}
+
+// Reports, whether Freeze() has been called.
+func (p *Parser) Frozen() bool { return p.frozen }
@@ -0,0 +1,76 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "fmt"
+import "testing"
+
+func firstGrammar() *Parser {
+	p := new(Parser).Construct()
+	ident := Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+		return Required{scanner.Ident,nil}.Parse(p,tokens,left)
+	})
+	closing := func(res ParserResult,tokens *scanlist.Element, left interface{}) ParserResult {
+		if !res.Ok() { return res }
+		if res.Next.SafeToken()!=')' { return ResultFailCut("missing ')'",res.Next.SafePos()) }
+		return ResultOk(res.Next.Next(),[]interface{}{"()",res.Data})
+	}
+	p.Define("Atom",false,Required{scanner.Int,nil})
+	p.Define("Atom",false,Action{ArraySeq{Required{'(',nil},Delegate("Sum")},closing})
+	p.Define("Atom",false,Switch{Cases:map[rune]ParseRule{'-':ArraySeq{Required{'-',nil},Delegate("Atom")},'!':Literal("!!")}})
+	p.Define("Atom",false,ident.First(scanner.Ident))
+	p.Define("Atom",false,Capture{ArraySeq{Set("$%"),Range{'a','z'}}})
+	p.Define("Sum",false,Delegate("Atom"))
+	p.Define("Sum",true,ArraySeq{Required{'+',nil},Delegate("Atom")})
+	p.Define("Sum",true,ArraySeq{Required{'*',nil},DelegateNoLeftRecursion("Sum")})
+	p.Define("List",false,ArraySeq{Required{'[',nil},ArrayStar{Delegate("Sum")},Required{']',nil}})
+	p.Define("List",false,TokenFinishedOptional{ArrayPlus{Delegate("Atom")},';'})
+	p.Define("List",false,LStar{Required{',',nil}})
+	p.Define("Top",false,ArraySeq{Delegate("List"),Required{scanner.EOF,nil}})
+	p.Define("Top",false,ArraySeq{Delegate("Sum"),Literal("=>"),Delegate("Top")})
+	return p
+}
+
+// A frozen grammar gives the same results (and errors) as the unfrozen one.
+func TestFreeze(t *testing.T) {
+	corpus := []string{
+		"", "1", "x", "(1)", "(1", "(1 2)", "-x", "--(y)", "!!", "!", "$ a", "% 3",
+		"1 + 2 * 3", "1 +", "1 * * 2", "[ ]", "[ 1 x + 2 ]", "[ 1", "1 2 x;", "1 2 3 ; 4",
+		", , ,", ",", ";", "x => y => [1]", "x =>", "x = > y", "?", "@ 1", ")",
+	}
+	run := func(p *Parser,rule,src string) string {
+		r := p.Match(rule,scan(src))
+		return fmt.Sprint(r.Result," ",r.Data," ",r.Pos," ",r.Next.SafeTokenText()," ",r.Next.SafePos())
+	}
+	a,b := firstGrammar(),firstGrammar()
+	b.Freeze()
+	for _,src := range corpus {
+		for _,rule := range []string{"Atom","Sum","List","Top"} {
+			if x,y := run(a,rule,src),run(b,rule,src); x!=y { t.Errorf("%s %q:\n\tunfrozen %s\n\tfrozen   %s",rule,src,x,y) }
+		}
+	}
+}
@@ -0,0 +1,45 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+
+/*
+Parses Inner on the input, re-lexed with the lexer mode Mode pushed. If Inner
+succeeds, the rest of the input is re-lexed with the mode stack from before.
+This only has an effect on token lists from a scanlist.ModalLexer; see
+scanlist.Element.Relex.
+*/
+type InMode struct{
+	Mode int
+	Inner ParseRule
+}
+func (m InMode) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	s,ok := tokens.LexState()
+	if !ok { return m.Inner.Parse(p,tokens,left) }
+	res := m.Inner.Parse(p,tokens.Relex(s.Modes.Push(m.Mode)),left)
+	if res.Result==RESULT_OK { res.Next = res.Next.Relex(s.Modes) }
+	return res
+}
@@ -0,0 +1,54 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist/lexgen"
+import "text/scanner"
+import "fmt"
+import "testing"
+
+// Words in mode 0, single letters in mode 1.
+var modeLexer = lexgen.MustCompile(
+	lexgen.Regex(`[a-z]+`,scanner.Ident),
+	lexgen.Regex(`[a-z]`,scanner.Char).In(1),
+	lexgen.Skip(` +`),
+	lexgen.Skip(` +`).In(1),
+)
+
+func TestInMode(t *testing.T) {
+	p := new(Parser).Construct()
+	p.Define("S",false,ArraySeq{Required{scanner.Ident,nil},InMode{1,ArraySeq{Required{scanner.Char,nil},Required{scanner.Char,nil}}},Required{scanner.Ident,nil}})
+	r := p.Match("S",modeLexer.Scan("","ab cd ef"))
+	if !r.Ok() { t.Fatal(r.Data) }
+	if got := fmt.Sprint(r.Data); got!="[ab [c d] ef]" { t.Errorf("got %s",got) }
+	if r.Next!=nil { t.Errorf("left %q",r.Next.TokenText) }
+	
+	// Without the mode, "cd" is one word.
+	if r := p.Match("S",modeLexer.Scan("","ab cd")); r.Ok() { t.Errorf("ok: %v",r.Data) }
+	
+	// On a list without lexer states, InMode is just its Inner rule.
+	p.Define("W",false,InMode{1,Required{scanner.Ident,nil}})
+	if r := p.Match("W",scan("ab")); !r.Ok() || r.Data!="ab" { t.Errorf("got %v",r.Data) }
+}
@@ -0,0 +1,106 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "strings"
+
+/*
+Returns the grammar module name, nested in p's module. Rules, defined through
+the returned Parser, are named "name.Rule" (relative to p's module). Rule
+names, used within the module (including Delegates and p.Match() calls from
+Pfuncs), are resolved relative to the module, in which the calling rule has
+been defined. Rules of other modules must be imported explicitly:
+
+	sql := p.Module("sql")
+	RegisterSQL(sql)
+	c := p.Module("c")
+	cparse.RegisterExpr(c)
+	c.Import("SQLExpr","sql.Expr")
+	c.Export("Expr")
+*/
+func (p *Parser) Module(name string) *Parser {
+	return p.In(p.ns+name+".")
+}
+
+// Returns a view into the module with the absolute name prefix ns ("" for the root module).
+func (p *Parser) In(ns string) *Parser {
+	return &Parser{p.parserCore,ns}
+}
+
+// Returns the absolute name prefix of p's module.
+func (p *Parser) Namespace() string { return p.ns }
+
+/*
+Makes the rule target (an absolute rule name) available under the name local
+within p's module.
+*/
+func (p *Parser) Import(local, target string) {
+	if p.frozen { panic("grammar frozen") }
+	p.aliases[p.ns+local] = target
+}
+
+// Makes the rule n of p's module available in the parent module under the same name.
+func (p *Parser) Export(n string) {
+	p.ExportAs(n,n)
+}
+
+// Makes the rule n of p's module available in the parent module under the name as.
+func (p *Parser) ExportAs(n, as string) {
+	if p.ns=="" { return }
+	parent := p.ns[:strings.LastIndex(p.ns[:len(p.ns)-1],".")+1]
+	p.In(parent).Import(as,p.ns+n)
+}
+
+// Returns the imports of all modules, mapping absolute names to absolute names.
+func (p *Parser) Imports() map[string]string {
+	m := make(map[string]string,len(p.aliases))
+	for k,v := range p.aliases { m[k] = v }
+	return m
+}
+
+/*
+Resolves the rule name n, relative to p's module, into an absolute rule name.
+Names with a leading "." are absolute already.
+*/
+func (p *Parser) Resolve(n string) string {
+	if strings.HasPrefix(n,".") {
+		n = n[1:]
+	} else {
+		n = p.ns+n
+	}
+	for i := 0; i<len(p.aliases); i++ {
+		t,ok := p.aliases[n]
+		if !ok { break }
+		n = t
+	}
+	return n
+}
+
+// Returns a view into the module, the (absolute) rule n has been defined in.
+func (p *Parser) RuleModule(n string) *Parser {
+	rp,ok := p.rules[n]
+	if !ok || rp.ns==p.ns { return p }
+	return p.In(rp.ns)
+}
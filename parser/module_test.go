@@ -0,0 +1,105 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "fmt"
+import "testing"
+
+func TestModuleResolve(t *testing.T) {
+	p := new(Parser).Construct()
+	a := p.Module("a")
+	b := a.Module("b")
+	a.Import("E","a.b.Expr")
+	p.Import("E","a.E")
+	b.Export("Stmt")
+	b.ExportAs("Decl","D")
+	p.Export("X") // The root module has no parent.
+	if a.Namespace()!="a." || b.Namespace()!="a.b." || p.In("a.b.").Namespace()!="a.b." { t.Error("Namespace") }
+	for _,c := range []struct{ m *Parser; n,want string }{
+		{a,"X","a.X"},
+		{a,".X","X"},
+		{b,"X","a.b.X"},
+		{b,".a.X","a.X"},
+		{a,"E","a.b.Expr"},
+		{p,"E","a.b.Expr"}, // Aliases of aliases.
+		{b,"E","a.b.E"},
+		{a,"Stmt","a.b.Stmt"},
+		{a,"D","a.b.Decl"},
+		{a,"Decl","a.Decl"},
+		{p,"X","X"},
+	} {
+		if got := c.m.Resolve(c.n); got!=c.want { t.Errorf("%q in %q: got %q, want %q",c.n,c.m.Namespace(),got,c.want) }
+	}
+	im := p.Imports()
+	if len(im)!=4 || im["a.E"]!="a.b.Expr" || im["E"]!="a.E" { t.Errorf("Imports: %v",im) }
+	im["Y"] = "Z"
+	if p.Resolve("Y")!="Y" { t.Error("Imports returns the aliases themselves") }
+}
+
+// Rule names within a module, also those of Pfuncs, are resolved relative to it.
+func TestModuleMatch(t *testing.T) {
+	p := new(Parser).Construct()
+	n := p.Module("num")
+	n.Define("Num",false,Required{scanner.Int,nil})
+	n.Define("List",false,ArraySeq{Delegate("Num"),ArrayStar{ArraySeq{Required{',',nil},Delegate("Num")}}})
+	n.Define("Last",false,Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+		return p.Match("Num",tokens.Next())
+	}))
+	p.Define("Num",false,Required{scanner.Ident,nil})
+	p.Import("Nums","num.List")
+	p.Define("Top",false,ArraySeq{Delegate("Num"),Delegate("Nums"),Delegate(".num.Last")})
+	
+	r := p.Match("Top",scan("x 1 , 2 ; 3"))
+	if !r.Ok() || fmt.Sprint(r.Data)!="[x [1 [[, 2]]] 3]" { t.Errorf("Top: %v",r.Data) }
+	if r := p.Match("Num",scan("1")); r.Ok() { t.Error("Num matches the rule of num") }
+	if r := n.Match("Num",scan("1")); !r.Ok() { t.Errorf("num.Num: %v",r.Data) }
+	if r := p.In("num.").Match("List",scan("1 , 2")); !r.Ok() { t.Errorf("num.List: %v",r.Data) }
+	if p.RuleModule("num.List").Namespace()!="num." || p.RuleModule("Top").Namespace()!="" { t.Error("RuleModule") }
+	
+	// Freeze computes the FIRST sets within the modules as well.
+	p.Freeze()
+	if r := p.Match("Top",scan("x 1 , 2 ; 3")); !r.Ok() || fmt.Sprint(r.Data)!="[x [1 [[, 2]]] 3]" { t.Errorf("frozen Top: %v",r.Data) }
+}
+
+// Alias cycles and undefined (qualified) rules are undefined rules.
+func TestModuleUndefined(t *testing.T) {
+	for _,name := range []string{"A","num.Nope","Num",".num.Num.x"} {
+		p := new(Parser).Construct()
+		p.Module("num").Define("Num",false,Required{scanner.Int,nil})
+		p.Import("A","B")
+		p.Import("B","A")
+		p.Define("Top",false,Delegate(name))
+		if r := p.Resolve("A"); r!="A" && r!="B" { t.Errorf("cycle: resolved to %q",r) }
+		func() {
+			defer func() {
+				if e := recover(); e!="rule not defined" { t.Errorf("%s: got panic %v",name,e) }
+			}()
+			p.Match("Top",scan("1"))
+			t.Errorf("%s: no panic",name)
+		}()
+	}
+}
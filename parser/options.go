@@ -0,0 +1,167 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "fmt"
+import "os"
+
+// Options of a rule, see DefineWith().
+type RuleOptions struct{
+	// The alternative is left-recursive (like the left argument of Define()).
+	Left bool
+	
+	// A human readable name, like "expression". If the rule fails at its
+	// first token, the error becomes "Unexpected X, expected <Label>".
+	Label string
+	
+	// The results are memoized per start token (packrat parsing), for the
+	// duration of the top-level Match() call (or between the parses of a
+	// Document).
+	Memoize bool
+	
+	// The rule doesn't appear in the CST; its children are added to its parent.
+	Hidden bool
+	
+	// Invocations are logged to TraceOut.
+	Trace bool
+}
+
+/*
+Like Define(), but with options. Except Left, the options apply to the whole
+rule and are merged with the ones given before. If r is nil, only the options
+are set.
+*/
+func (p *Parser) DefineWith(n string,o RuleOptions,r ParseRule) {
+	if p.frozen { panic("grammar frozen") }
+	if r!=nil { p.Define(n,o.Left,r) }
+	rp := p.rule(n,true)
+	if rp.opts==nil {
+		if o.Label=="" && !o.Memoize && !o.Hidden && !o.Trace { return }
+		rp.opts = new(RuleOptions)
+	}
+	if o.Label!="" { rp.opts.Label = o.Label }
+	rp.opts.Memoize = rp.opts.Memoize || o.Memoize
+	rp.opts.Hidden = rp.opts.Hidden || o.Hidden
+	rp.opts.Trace = rp.opts.Trace || o.Trace
+}
+
+// Like DefineWith(), but with flags (LEFT_RECURSIVE, MEMOIZE, HIDDEN, TRACE).
+func (p *Parser) DefineFlags(n string,flags uint,r ParseRule) {
+	p.DefineWith(n,RuleOptions{
+		Left: flags&LEFT_RECURSIVE!=0,
+		Memoize: flags&MEMOIZE!=0,
+		Hidden: flags&HIDDEN!=0,
+		Trace: flags&TRACE!=0,
+	},r)
+}
+
+// Returns the options of the rule n (Left is always false).
+func (p *Parser) RuleOptions(n string) (o RuleOptions) {
+	rp := p.rule(n,false)
+	if rp!=nil && rp.opts!=nil { o = *rp.opts }
+	return
+}
+
+type memoKey struct{
+	rp *ruleParser
+	phaseTwo bool
+	tokens *scanlist.Element
+}
+type memoEntry struct{
+	res ParserResult
+	nodes []*Node // the CST nodes, contributed to the parent
+	extent int // how far the rule has looked (see scanlist.Tracker); only with a Document
+}
+
+// Drops all memoized results. Only needed within a Pfunc, that changes the parse state.
+func (p *Parser) ClearMemo() { p.memo = nil }
+
+func (p *Parser) trace(format string,args ...interface{}) {
+	w := p.TraceOut
+	if w==nil { w = os.Stderr }
+	for i := 0; i<p.traceDepth; i++ { fmt.Fprint(w,"  ") }
+	fmt.Fprintf(w,format+"\n",args...)
+}
+
+var noOptions RuleOptions
+
+// Returns, whether ruleEnter() and ruleExit() have to be called for rp.
+func (p *Parser) hooked(rp *ruleParser) bool { return rp.opts!=nil || p.memoAll }
+
+// Called before the rule rp is run. Returns the result, if it is memoized.
+func (p *Parser) ruleEnter(rp *ruleParser,phaseTwo bool,tokens *scanlist.Element) (ParserResult,bool) {
+	o := rp.opts
+	if o==nil { o = &noOptions }
+	if o.Memoize || p.memoAll {
+		if m,ok := p.memo[memoKey{rp,phaseTwo,tokens}]; ok {
+			if o.Trace { p.trace("%s at %v: memoized",rp.name,tokens.SafePos()) }
+			if p.BuildCST && m.res.Result==RESULT_OK { p.cstAdd(m.nodes) }
+			if p.tracker!=nil { p.tracker.Saw(m.extent) }
+			return m.res,true
+		}
+		if p.tracker!=nil {
+			p.extents = append(p.extents,p.tracker.Max)
+			p.tracker.Max = scanlist.EndOffset(tokens)
+		}
+	}
+	if o.Trace {
+		p.trace("%s at %v",rp.name,tokens.SafePos())
+		p.traceDepth++
+	}
+	return ParserResult{},false
+}
+
+// Called after the rule rp has been run. Returns the (relabeled) result.
+func (p *Parser) ruleExit(rp *ruleParser,phaseTwo bool,tokens *scanlist.Element,res ParserResult,nodes []*Node) ParserResult {
+	o := rp.opts
+	if o==nil { o = &noOptions }
+	if o.Label!="" && res.Result==RESULT_FAILED && res.Pos==tokens.SafePos() {
+		un := Textify(tokens.SafeToken())
+		if tokens!=nil { un = "'"+tokens.TokenText+"'" }
+		res = ResultFail(fmt.Sprintf("Unexpected %s, expected %s",un,o.Label),res.Pos)
+	}
+	if o.Memoize || p.memoAll {
+		if p.memo==nil { p.memo = make(map[memoKey]memoEntry) }
+		m := memoEntry{res:res,nodes:nodes}
+		if p.tracker!=nil {
+			i := len(p.extents)-1
+			m.extent = p.tracker.Max
+			p.tracker.Max = p.extents[i]
+			p.extents = p.extents[:i]
+			p.tracker.Saw(m.extent)
+		}
+		p.memo[memoKey{rp,phaseTwo,tokens}] = m
+	}
+	if o.Trace {
+		p.traceDepth--
+		if res.Result==RESULT_OK {
+			p.trace("%s ok, next at %v",rp.name,res.Next.SafePos())
+		} else {
+			p.trace("%s failed: %v",rp.name,res.Data)
+		}
+	}
+	return res
+}
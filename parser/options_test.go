@@ -0,0 +1,114 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "strings"
+import "bytes"
+import "testing"
+
+func scan(src string) *scanlist.Element {
+	s := new(scanlist.BaseScanner)
+	s.Init(strings.NewReader(src))
+	return s.Next()
+}
+
+// A failure at the first token is relabeled, a failure further in is not.
+func TestLabel(t *testing.T) {
+	p := new(Parser).Construct()
+	p.DefineWith("Num",RuleOptions{Label:"number"},Required{scanner.Int,nil})
+	p.DefineWith("Sum",RuleOptions{Label:"sum"},ArraySeq{Delegate("Num"),Required{'+',nil},Delegate("Num")})
+	for _,c := range []struct{ rule,src,want string }{
+		{"Num","x","Unexpected 'x', expected number"},
+		{"Sum","x","Unexpected 'x', expected sum"},
+		{"Sum","1 + x","Unexpected 'x', expected number"},
+		{"Sum","1 x",""},
+	}{
+		r := p.Match(c.rule,scan(c.src))
+		if r.Ok() { t.Errorf("%s %q: ok",c.rule,c.src); continue }
+		if c.want=="" {
+			if strings.Contains(r.Data.(string),"expected sum") { t.Errorf("%s %q: relabeled as %v",c.rule,c.src,r.Data) }
+		} else if r.Data!=c.want {
+			t.Errorf("%s %q: got %v, want %s",c.rule,c.src,r.Data,c.want)
+		}
+	}
+}
+
+// A memoized rule runs once per start token.
+func TestMemoize(t *testing.T) {
+	p := new(Parser).Construct()
+	calls := 0
+	p.DefineFlags("X",MEMOIZE,Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+		calls++
+		return Required{scanner.Ident,nil}.Parse(p,tokens,left)
+	}))
+	p.Define("Top",false,OR{LSeq{Delegate("X"),Required{'+',nil}},Delegate("X")})
+	if r := p.Match("Top",scan("a")); !r.Ok() { t.Fatal(r.Data) }
+	if calls!=1 { t.Errorf("X called %d times",calls) }
+}
+
+// The children of a hidden rule are added to its parent.
+func TestHidden(t *testing.T) {
+	p := new(Parser).Construct()
+	p.BuildCST = true
+	p.Define("A",false,Required{scanner.Ident,nil})
+	p.DefineFlags("H",HIDDEN,ArraySeq{Delegate("A"),Delegate("A")})
+	p.Define("Top",false,ArraySeq{Delegate("H"),Delegate("A")})
+	if r := p.Match("Top",scan("a b c")); !r.Ok() { t.Fatal(r.Data) }
+	n := p.CST()
+	var names []string
+	for _,c := range n.Children { names = append(names,c.Name) }
+	if n.Name!="Top" || strings.Join(names," ")!="A A A" { t.Errorf("%s: %v",n.Name,names) }
+}
+
+// Traced invocations are logged, nested ones indented.
+func TestTrace(t *testing.T) {
+	p := new(Parser).Construct()
+	b := new(bytes.Buffer)
+	p.TraceOut = b
+	p.DefineFlags("A",TRACE,Required{scanner.Ident,nil})
+	p.DefineFlags("Top",TRACE,ArraySeq{Delegate("A"),Delegate("A")})
+	p.Match("Top",scan("a 1"))
+	want := "Top at <input>:1:2\n  A at <input>:1:2\n  A ok, next at <input>:1:4\n  A at <input>:1:4\n  A failed: "
+	if !strings.HasPrefix(b.String(),want) || !strings.Contains(b.String(),"\nTop failed: ") { t.Errorf("got\n%s",b) }
+}
+
+// The memo is scoped to a single top-level Match.
+func TestMemoScope(t *testing.T) {
+	p := new(Parser).Construct()
+	calls := 0
+	p.DefineFlags("X",MEMOIZE,Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+		calls++
+		return Required{scanner.Ident,nil}.Parse(p,tokens,left)
+	}))
+	p.Define("Top",false,OR{LSeq{Delegate("X"),Required{'+',nil}},Delegate("X")})
+	l := scan("a")
+	for i := 1; i<=2; i++ {
+		if r := p.Match("Top",l); !r.Ok() { t.Fatal(r.Data) }
+		if calls!=i { t.Errorf("match %d: X called %d times",i,calls) }
+		if len(p.memo)!=0 { t.Errorf("match %d: %d memo entries left",i,len(p.memo)) }
+	}
+}
@@ -0,0 +1,292 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "reflect"
+import "runtime"
+import "strconv"
+import "strings"
+import "sort"
+import "sync"
+import "unsafe"
+import "fmt"
+
+type paramRule struct{
+	ns string
+	f func(args ...ParseRule) ParseRule
+	inst map[string]string // argument key (see argKey) -> absolute instance name
+}
+
+/*
+Defines a parameterized rule. It is invoked through DelegateWith(), which
+instantiates it once per distinct argument list. Instances are ordinary rules
+of the module, DefineParam has been called on, named like "List<Expr,','>".
+*/
+func (p *Parser) DefineParam(n string,f func(args ...ParseRule) ParseRule) {
+	if p.frozen { panic("grammar frozen") }
+	if p.params==nil { p.params = make(map[string]*paramRule) }
+	p.params[p.ns+n] = &paramRule{p.ns,f,make(map[string]string)}
+}
+
+// An invocation of a parameterized rule, see DelegateWith().
+type ParamDelegate struct{
+	Name string
+	Args []ParseRule
+	inst sync.Map // caller module -> absolute instance name
+}
+
+/*
+Invokes the parameterized rule n with the given arguments. Rule names within
+the arguments are resolved relative to the calling module.
+
+	p.DefineParam("List",func(args ...parser.ParseRule) parser.ParseRule {
+		return parser.ArraySeq{args[0],parser.ArrayStar{parser.ArraySeq{args[1],args[0]}}}
+	})
+	p.Define("Args",false,parser.DelegateWith("List",parser.Delegate("Expr"),parser.Required{',',nil}))
+*/
+func DelegateWith(n string,args ...ParseRule) *ParamDelegate {
+	return &ParamDelegate{Name:n,Args:args}
+}
+
+func (d *ParamDelegate) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	return p.Match("."+d.Instance(p),tokens)
+}
+
+// Returns the absolute name of the instance for the calling module p, instantiating it, if neccessary.
+func (d *ParamDelegate) Instance(p *Parser) string {
+	if n,ok := d.inst.Load(p.ns); ok { return n.(string) }
+	
+	pn := p.Resolve(d.Name)
+	pr,ok := p.params[pn]
+	if !ok { panic("parameterized rule not defined: "+pn) }
+	args := make([]ParseRule,len(d.Args))
+	names := make([]string,len(d.Args))
+	for i,a := range d.Args {
+		args[i] = absolutize(p,a)
+		names[i] = RuleName(args[i])
+	}
+	k := argKey(args)
+	n,ok := pr.inst[k]
+	if !ok {
+		// Arguments, that behave differently, may have the same name.
+		n = pn+"<"+strings.Join(names,",")+">"
+		for i,b := 2,n; p.rules[n]!=nil; i++ { n = fmt.Sprint(b,"#",i) }
+		if p.frozen { panic("grammar frozen: can't instantiate "+n) }
+		p.In(pr.ns).Define("."+n,false,pr.f(args...))
+		pr.inst[k] = n
+	}
+	d.inst.Store(p.ns,n)
+	return n
+}
+
+/*
+Returns a key for an argument list, that is the same for arguments, that
+behave the same: combinators are compared by structure, functions (Pfunc,
+Action.F, Required.Errf, ...) and pointers by identity.
+*/
+func argKey(args []ParseRule) string {
+	var b strings.Builder
+	writeKey(&b,reflect.ValueOf(args))
+	return b.String()
+}
+
+var paramDelegateType = reflect.TypeOf((*ParamDelegate)(nil))
+
+func writeKey(b *strings.Builder,v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Invalid: b.WriteString("nil")
+	case reflect.Interface:
+		if v.IsNil() { b.WriteString("nil") } else { writeKey(b,v.Elem()) }
+	case reflect.Ptr:
+		if v.Type()==paramDelegateType && !v.IsNil() { // absolutize() creates new ones.
+			fmt.Fprintf(b,"with(%q,",v.Elem().FieldByName("Name").String())
+			writeKey(b,v.Elem().FieldByName("Args"))
+			b.WriteString(")")
+			break
+		}
+		fmt.Fprintf(b,"%v@%x",v.Type(),v.Pointer())
+	case reflect.Func: fmt.Fprintf(b,"%v@%x",v.Type(),funcID(v))
+	case reflect.Slice,reflect.Array:
+		fmt.Fprintf(b,"%v[",v.Type())
+		for i := 0; i<v.Len(); i++ { writeKey(b,v.Index(i)); b.WriteString(",") }
+		b.WriteString("]")
+	case reflect.Map:
+		keys := make([]string,0,v.Len())
+		for it := v.MapRange(); it.Next(); {
+			var e strings.Builder
+			writeKey(&e,it.Key())
+			e.WriteString(":")
+			writeKey(&e,it.Value())
+			keys = append(keys,e.String())
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(b,"%v{%s}",v.Type(),strings.Join(keys,","))
+	case reflect.Struct:
+		fmt.Fprintf(b,"%v{",v.Type())
+		for i := 0; i<v.NumField(); i++ { writeKey(b,v.Field(i)); b.WriteString(",") }
+		b.WriteString("}")
+	case reflect.Chan,reflect.UnsafePointer: fmt.Fprintf(b,"%v@%x",v.Type(),v.Pointer())
+	default: fmt.Fprintf(b,"%v(%v)",v.Type(),v)
+	}
+}
+
+/*
+Returns the identity of a function value. Unlike v.Pointer(), which is the
+code address, it tells apart closures of the same function literal.
+*/
+func funcID(v reflect.Value) uintptr {
+	if v.IsNil() { return 0 }
+	if !v.CanInterface() { return v.Pointer() }
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	return *(*uintptr)(unsafe.Pointer(c.Pointer()))
+}
+
+// Rewrites the rule names in r into absolute ones (see Resolve()).
+func absolutize(p *Parser,r ParseRule) ParseRule {
+	abs := func(rs []ParseRule) []ParseRule {
+		n := make([]ParseRule,len(rs))
+		for i,r := range rs { n[i] = absolutize(p,r) }
+		return n
+	}
+	switch v := r.(type) {
+	case Delegate: return Delegate("."+p.Resolve(string(v)))
+	case DelegateNoLeftRecursion: return DelegateNoLeftRecursion("."+p.Resolve(string(v)))
+	case *ParamDelegate: return DelegateWith("."+p.Resolve(v.Name),abs(v.Args)...)
+	case OR: return OR(abs(v))
+	case LSeq: return LSeq(abs(v))
+	case ArraySeq: return ArraySeq(abs(v))
+	case LStar: return LStar{absolutize(p,v.Inner)}
+	case LPlus: return LPlus{absolutize(p,v.Inner)}
+	case ArrayStar: return ArrayStar{absolutize(p,v.Inner)}
+	case ArrayPlus: return ArrayPlus{absolutize(p,v.Inner)}
+	case TokenFinishedOptional: return TokenFinishedOptional{absolutize(p,v.Inner),v.Token}
+	case Action: return Action{absolutize(p,v.Inner),v.F}
+	case Capture: return Capture{absolutize(p,v.Inner)}
+	case InMode: return InMode{v.Mode,absolutize(p,v.Inner)}
+	case First:
+		if v.As!=nil { return First{absolutize(p,v.Inner),v.Tokens,absolutize(p,v.As)} }
+		return First{absolutize(p,v.Inner),v.Tokens,nil}
+	case Switch:
+		c := make(map[rune]ParseRule,len(v.Cases))
+		for t,r := range v.Cases { c[t] = absolutize(p,r) }
+		if v.Default==nil { return Switch{c,nil} }
+		return Switch{c,absolutize(p,v.Default)}
+	}
+	return r
+}
+
+/*
+Instantiates all parameterized rules, that are invoked from the combinators
+of the grammar (but not those, invoked from within Pfuncs). Called by Freeze().
+*/
+func (p *Parser) InstantiateAll() {
+	done := make(map[*ruleParser]bool)
+	for {
+		var todo []*ruleParser
+		for _,rp := range p.rules {
+			if !done[rp] { todo = append(todo,rp) }
+		}
+		if len(todo)==0 { return }
+		for _,rp := range todo {
+			done[rp] = true
+			q := p.In(rp.ns)
+			for _,r := range rp.phase1 { walkParams(q,r) }
+			for _,r := range rp.phase2 { walkParams(q,r) }
+		}
+	}
+}
+
+func walkParams(p *Parser,r ParseRule) {
+	switch v := r.(type) {
+	case *ParamDelegate:
+		v.Instance(p)
+		for _,a := range v.Args { walkParams(p,a) }
+	case OR: for _,r := range v { walkParams(p,r) }
+	case LSeq: for _,r := range v { walkParams(p,r) }
+	case ArraySeq: for _,r := range v { walkParams(p,r) }
+	case LStar: walkParams(p,v.Inner)
+	case LPlus: walkParams(p,v.Inner)
+	case ArrayStar: walkParams(p,v.Inner)
+	case ArrayPlus: walkParams(p,v.Inner)
+	case TokenFinishedOptional: walkParams(p,v.Inner)
+	case Action: walkParams(p,v.Inner)
+	case Capture: walkParams(p,v.Inner)
+	case InMode: walkParams(p,v.Inner)
+	case First:
+		walkParams(p,v.Inner)
+		if v.As!=nil { walkParams(p,v.As) }
+	case Switch:
+		for _,r := range v.Cases { walkParams(p,r) }
+		if v.Default!=nil { walkParams(p,v.Default) }
+	}
+}
+
+// Returns a human readable name for r, as used for the instances of parameterized rules.
+func RuleName(r ParseRule) string {
+	names := func(rs []ParseRule,sep string) string {
+		n := make([]string,len(rs))
+		for i,r := range rs { n[i] = RuleName(r) }
+		return strings.Join(n,sep)
+	}
+	switch v := r.(type) {
+	case Delegate: return strings.TrimPrefix(string(v),".")
+	case DelegateNoLeftRecursion: return strings.TrimPrefix(string(v),".")
+	case *ParamDelegate: return strings.TrimPrefix(v.Name,".")+"<"+names(v.Args,",")+">"
+	case Required: return Textify(v.Token)
+	case RequireText: return strconv.Quote(v.Text)
+	case OR: return "("+names(v," | ")+")"
+	case LSeq: return "("+names(v," ")+")"
+	case ArraySeq: return "("+names(v," ")+")"
+	case LStar: return RuleName(v.Inner)+"*"
+	case ArrayStar: return RuleName(v.Inner)+"*"
+	case LPlus: return RuleName(v.Inner)+"+"
+	case ArrayPlus: return RuleName(v.Inner)+"+"
+	case TokenFinishedOptional: return "["+RuleName(v.Inner)+"] "+Textify(v.Token)
+	case First: return RuleName(v.Inner)
+	case Action: return RuleName(v.Inner)
+	case Capture: return RuleName(v.Inner)
+	case InMode: return RuleName(v.Inner)
+	case Range: return Textify(v.Lo)+".."+Textify(v.Hi)
+	case Set: return "["+string(v)+"]"
+	case NotSet: return "[^"+string(v)+"]"
+	case Literal: return strconv.Quote(string(v))
+	case Switch:
+		keys := make([]int,0,len(v.Cases))
+		for t := range v.Cases { keys = append(keys,int(t)) }
+		sort.Ints(keys)
+		n := make([]string,0,len(keys)+1)
+		for _,t := range keys { n = append(n,Textify(rune(t))+": "+RuleName(v.Cases[rune(t)])) }
+		if v.Default!=nil { n = append(n,"default: "+RuleName(v.Default)) }
+		return "switch{"+strings.Join(n,"; ")+"}"
+	case Pfunc:
+		if f := runtime.FuncForPC(reflect.ValueOf(v).Pointer()); f!=nil {
+			n := f.Name()
+			return n[strings.LastIndex(n,".")+1:]
+		}
+	}
+	return fmt.Sprintf("%T",r)
+}
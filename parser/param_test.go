@@ -0,0 +1,69 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "strings"
+import "testing"
+
+func mapText(f func(string) string) func(res ParserResult,tokens *scanlist.Element, left interface{}) ParserResult {
+	return func(res ParserResult,tokens *scanlist.Element, left interface{}) ParserResult {
+		if res.Ok() { res.Data = f(res.Data.(string)) }
+		return res
+	}
+}
+
+// Arguments with the same name, but a different behavior, must get their own instances.
+func TestParamInstances(t *testing.T) {
+	p := new(Parser).Construct()
+	p.DefineParam("One",func(args ...ParseRule) ParseRule { return args[0] })
+	p.Define("Id",false,RequireText{"foo"})
+	prefix := func(s string) Pfunc {
+		return func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+			r := p.Match("Id",tokens)
+			if r.Ok() { r.Data = s+r.Data.(string) }
+			return r
+		}
+	}
+	upper := mapText(strings.ToUpper)
+	cases := []struct{
+		rule *ParamDelegate
+		want string
+	}{
+		{DelegateWith("One",Action{Delegate("Id"),upper}),"FOO"},
+		{DelegateWith("One",Action{Delegate("Id"),mapText(strings.ToLower)}),"foo"},
+		{DelegateWith("One",prefix("a")),"afoo"},
+		{DelegateWith("One",prefix("b")),"bfoo"},
+		{DelegateWith("One",Action{Delegate("Id"),upper}),"FOO"}, // the same instance as the first
+	}
+	seen := make(map[string]bool)
+	for i,c := range cases {
+		r := c.rule.Parse(p,scanlist.FromTokens([]scanlist.Token{{Text:"foo"}}),nil)
+		if !r.Ok() || r.Data!=c.want { t.Errorf("case %d: got %v, want %q",i,r.Data,c.want) }
+		seen[c.rule.Instance(p)] = true
+	}
+	if len(seen)!=4 { t.Errorf("got instances %v, want 4",seen) }
+	if !seen["One<Id>"] || !seen["One<Id>#2"] { t.Errorf("missing numbered names in %v",seen) }
+}
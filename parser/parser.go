@@ -31,10 +31,18 @@ package parser
 import "text/scanner"
 import "github.com/byte-mug/semiparse/scanlist"
 import "fmt"
+import "sort"
+import "io"
+import "crypto/sha256"
+import "encoding/hex"
 
 const NONE = uint(0)
+// Rule flags, see DefineFlags().
 const (
 	LEFT_RECURSIVE = uint(1<<iota)
+	MEMOIZE
+	HIDDEN
+	TRACE
 )
 
 const (
@@ -69,6 +77,17 @@ func ResultFailCut(reason string, pos scanner.Position) ParserResult {
 	return ParserResult{RESULT_FAILED_CUT,nil,reason,pos}
 }
 
+/*
+Turns r, the failure of a rule invoked at tokens, into a cut failure, that
+reports the lexical error, if tokens is a LEX_ERROR element. Otherwise, r is
+returned as is. The cut keeps enclosing alternatives from backtracking over the
+broken token (and reporting some earlier token instead).
+*/
+func LexicalError(tokens *scanlist.Element, r ParserResult) ParserResult {
+	if r.Result!=RESULT_FAILED || tokens==nil || tokens.Token!=scanlist.LEX_ERROR { return r }
+	return ResultFailCut("Lexical error: "+tokens.TokenText,tokens.Pos)
+}
+
 type ParseRule interface{
 	// left = the Left-Recursive element, if any, else nil
 	Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult
@@ -83,10 +102,12 @@ type OR []ParseRule
 func (o OR) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (opr ParserResult) {
 	fail := false
 	for _,r := range o {
+		m := p.cstMark()
 		npr := r.Parse(p,tokens,left)
 		switch npr.Result {
 		case RESULT_OK: return npr
 		case RESULT_FAILED:
+			p.cstReset(m)
 			opr = npr
 			fail = true
 		case RESULT_FAILED_CUT:
@@ -104,9 +125,11 @@ type LStar struct {
 func (s LStar) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (opr ParserResult) {
 	opr = ResultOk(tokens,left)
 	for {
+		m := p.cstMark()
 		npr := s.Inner.Parse(p,tokens,left)
 		switch npr.Result {
 		case RESULT_FAILED:
+			p.cstReset(m)
 			return
 		case RESULT_FAILED_CUT: return npr
 		}
@@ -124,9 +147,11 @@ func (s LPlus) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (opr
 	if opr.Result!=RESULT_OK { return }
 	tokens = opr.Next
 	for {
+		m := p.cstMark()
 		npr := s.Inner.Parse(p,tokens,left)
 		switch npr.Result {
 		case RESULT_FAILED:
+			p.cstReset(m)
 			return
 		case RESULT_FAILED_CUT: return npr
 		}
@@ -143,9 +168,11 @@ type ArrayStar struct {
 func (s ArrayStar) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (ParserResult) {
 	dok := []interface{}{}
 	for {
+		m := p.cstMark()
 		npr := s.Inner.Parse(p,tokens,nil)
 		switch npr.Result {
 		case RESULT_FAILED:
+			p.cstReset(m)
 			return ResultOk(tokens,dok)
 		case RESULT_FAILED_CUT: return npr
 		}
@@ -165,9 +192,11 @@ func (s ArrayPlus) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (
 	tokens = npr.Next
 	dok := []interface{}{npr.Data}
 	for {
+		m := p.cstMark()
 		npr := s.Inner.Parse(p,tokens,nil)
 		switch npr.Result {
 		case RESULT_FAILED:
+			p.cstReset(m)
 			return ResultOk(tokens,dok)
 		case RESULT_FAILED_CUT: return npr
 		}
@@ -190,7 +219,7 @@ type RequireText struct {
 	Text string
 }
 func (r RequireText) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (ParserResult) {
-	if tokens.SafeTokenText()!=r.Text { return ResultFail(fmt.Sprint("Requirement not met: '%s' != '%s'",tokens.SafeTokenText(),r.Text),tokens.SafePos()) }
+	if tokens.SafeTokenText()!=r.Text { return ResultFail(fmt.Sprintf("Requirement not met: '%s' != '%s'",tokens.SafeTokenText(),r.Text),tokens.SafePos()) }
 	return ResultOk(tokens.SafeNext(),tokens.SafeTokenText())
 }
 
@@ -214,6 +243,40 @@ func (d Delegate) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (P
 	return p.Match(string(d),tokens)
 }
 
+// Like Delegate, but calls p.MatchNoLeftRecursion() rather than p.Match().
+type DelegateNoLeftRecursion string
+func (d DelegateNoLeftRecursion) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (ParserResult) {
+	return p.MatchNoLeftRecursion(string(d),tokens)
+}
+
+// Chooses a rule by the next token. If there is no case for it, Default is used.
+type Switch struct {
+	Cases map[rune]ParseRule
+	Default ParseRule
+}
+func (s Switch) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (ParserResult) {
+	if r,ok := s.Cases[tokens.SafeToken()]; ok { return r.Parse(p,tokens,left) }
+	if s.Default==nil { return ResultFail("no rules!",tokens.SafePos()) }
+	return s.Default.Parse(p,tokens,left)
+}
+
+/*
+Runs Inner and passes its result (success or failure) through F. tokens and
+left are the ones, Inner was called with.
+
+Freeze() assumes, that an Action starts with the FIRST set of Inner. So F must
+pass a RESULT_FAILED of Inner on through; turning it into a success or a
+RESULT_FAILED_CUT changes the results of a frozen grammar. Wrap such an Action
+into a First.
+*/
+type Action struct {
+	Inner ParseRule
+	F func(res ParserResult,tokens *scanlist.Element, left interface{}) ParserResult
+}
+func (a Action) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (ParserResult) {
+	return a.F(a.Inner.Parse(p,tokens,left),tokens,left)
+}
+
 type LSeq []ParseRule
 func (s LSeq) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (opr ParserResult) {
 	opr = ResultOk(tokens,left)
@@ -239,29 +302,132 @@ func (s ArraySeq) Parse(p *Parser,tokens *scanlist.Element, left interface{}) (o
 }
 
 type ruleParser struct{
+	name string
+	ns string // the module, the rule belongs to.
 	phase1 OR
 	phase2 OR
+	jump1 *dispatch // set by Freeze()
+	jump2 *dispatch // set by Freeze()
+	opts *RuleOptions // see DefineWith()
 }
 func (r *ruleParser) String() string{
 	return fmt.Sprint(r.phase1,r.phase2)
 }
 
-type Parser struct{
+type parserCore struct{
 	rules map[string]*ruleParser
+	aliases map[string]string // see Import() and Export()
+	params map[string]*paramRule // see DefineParam()
+	frozen bool
+	
+	// If set, rules are run by the iterative engine, rather than by recursion.
+	Iterative bool
+	
+	// If set, a concrete syntax tree is built. See CST().
+	BuildCST bool
+	cstStack [][]*Node
+	cst *Node
+	
+	state map[interface{}]interface{} // see State()
+	
+	memo map[memoKey]memoEntry // see RuleOptions.Memoize
+	memoAll bool // memoize all rules (see Document)
+	depth int // >0 within a top-level Match
+	tracker *scanlist.Tracker // see Document
+	extents []int
+	
+	// The output for rules with RuleOptions.Trace; os.Stderr if nil.
+	TraceOut io.Writer
+	traceDepth int
+}
+
+/*
+A Parser. Every Parser is a view into a grammar module: rule names, given to
+its methods, are relative to that module. See Module().
+
+A Parser (with its memo, CST and parse state) must not be used by several
+goroutines at once. Use Fork() instead.
+*/
+type Parser struct{
+	*parserCore
+	ns string
 }
 func (p *Parser) String() string{
 	return fmt.Sprint("{",p.rules,"}")
 }
 func (p *Parser) Construct() *Parser {
-	p.rules = make(map[string]*ruleParser)
+	p.parserCore = &parserCore{
+		rules: make(map[string]*ruleParser),
+		aliases: make(map[string]string),
+	}
+	p.ns = ""
 	return p
 }
-func (p *Parser) Define(n string,left bool,r ParseRule) {
+
+/*
+Returns the value stored under key in the parse state, or nil. The parse state
+is shared by all modules and allows rules to alter the parsing of subsequent
+input (for example by declaring operators). It is not rolled back on
+backtracking.
+*/
+func (p *Parser) State(key interface{}) interface{} {
+	return p.state[key]
+}
+
+// Stores v under key in the parse state. See State().
+func (p *Parser) SetState(key, v interface{}) {
+	if p.state==nil { p.state = make(map[interface{}]interface{}) }
+	p.state[key] = v
+}
+
+/*
+A value of the parse state, that is copied by Fork(), instead of being shared
+with the fork. Mutable values, like tables, that rules write to, should
+implement it.
+*/
+type StateForker interface{
+	ForkState() interface{}
+}
+
+/*
+Returns a new Parser, that shares the grammar with p, but has its own
+per-parse state (the CST and the parse state, see State()). The parse state is
+copied shallowly, except for StateForker values, which are copied by their
+ForkState() method. Forks of a frozen grammar may be used concurrently.
+*/
+func (p *Parser) Fork() *Parser {
+	c := &parserCore{
+		rules: p.rules,
+		aliases: p.aliases,
+		params: p.params,
+		frozen: p.frozen,
+		Iterative: p.Iterative,
+		BuildCST: p.BuildCST,
+		TraceOut: p.TraceOut,
+	}
+	q := &Parser{c,p.ns}
+	for k,v := range p.state {
+		if f,ok := v.(StateForker); ok { v = f.ForkState() }
+		q.SetState(k,v)
+	}
+	return q
+}
+
+// Returns the rule n (relative to p's module), creating it, if create is set.
+func (p *Parser) rule(n string,create bool) *ruleParser {
+	n = p.Resolve(n)
 	rp,ok := p.rules[n]
-	if !ok {
-		rp = new(ruleParser)
+	if !ok && create {
+		if p.frozen { panic("grammar frozen") }
+		rp = &ruleParser{name:n,ns:p.ns}
 		p.rules[n] = rp
 	}
+	return rp
+}
+
+func (p *Parser) Define(n string,left bool,r ParseRule) {
+	if p.frozen { panic("grammar frozen") }
+	rp := p.rule(n,true)
 	if left {
 		rp.phase2 = append(rp.phase2,r)
 	} else {
@@ -271,11 +437,8 @@ func (p *Parser) Define(n string,left bool,r ParseRule) {
 
 // Like .Define(), but does prepend rather than append!
 func (p *Parser) DefineBefore(n string,left bool,r ParseRule) {
-	rp,ok := p.rules[n]
-	if !ok {
-		rp = new(ruleParser)
-		p.rules[n] = rp
-	}
+	if p.frozen { panic("grammar frozen") }
+	rp := p.rule(n,true)
 	if left {
 		rp.phase2 = append(OR{r},rp.phase2...)
 	} else {
@@ -283,20 +446,101 @@ func (p *Parser) DefineBefore(n string,left bool,r ParseRule) {
 	}
 }
 func (p *Parser) TouchRule(n string) {
-	_,ok := p.rules[n]
-	if !ok {
-		p.rules[n] = new(ruleParser)
+	if p.frozen { panic("grammar frozen") }
+	p.rule(n,true)
+}
+
+// Returns the (absolute) names of all defined rules, sorted.
+func (p *Parser) Rules() []string {
+	names := make([]string,0,len(p.rules))
+	for n := range p.rules { names = append(names,n) }
+	sort.Strings(names)
+	return names
+}
+
+// Returns the alternatives of the rule n: phase1 are the ordinary ones, phase2 the left-recursive ones.
+func (p *Parser) Alternatives(n string) (phase1, phase2 []ParseRule) {
+	rp := p.rule(n,false)
+	if rp==nil { return }
+	return rp.phase1,rp.phase2
+}
+/*
+Returns a hash over the rule names and the structure of their alternatives
+(see RuleName()). It changes, when the grammar changes, but not when the code
+of a Pfunc changes.
+*/
+func (p *Parser) Fingerprint() string {
+	h := sha256.New()
+	for _,n := range p.Rules() {
+		rp := p.rules[n]
+		fmt.Fprintf(h,"%q\n",n)
+		for _,r := range rp.phase1 { fmt.Fprintf(h,"\t%q\n",RuleName(r)) }
+		for _,r := range rp.phase2 { fmt.Fprintf(h,"\t+%q\n",RuleName(r)) }
 	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 func (p *Parser) matchLowLevel(n string,phaseTwo bool,tokens *scanlist.Element) ParserResult {
-	rp,ok := p.rules[n]
-	if !ok { panic("rule not defined") }
+	if p.depth==0 { return p.matchTop(n,phaseTwo,tokens) }
+	rp := p.rule(n,false)
+	if rp==nil { panic("rule not defined") }
+	if rp.ns!=p.ns { p = p.In(rp.ns) }
+	if p.Iterative { return p.runEngine(rp,phaseTwo,tokens) }
+	if p.hooked(rp) {
+		if res,ok := p.ruleEnter(rp,phaseTwo,tokens); ok { return res }
+	}
+	var res ParserResult
+	var nodes []*Node
+	if p.BuildCST {
+		p.cstEnter()
+		res = LexicalError(tokens,p.matchRule(rp,phaseTwo,tokens))
+		nodes = p.cstLeave(rp,tokens,res)
+	} else {
+		res = LexicalError(tokens,p.matchRule(rp,phaseTwo,tokens))
+	}
+	if p.hooked(rp) { res = p.ruleExit(rp,phaseTwo,tokens,res,nodes) }
+	return res
+}
+/*
+A top-level Match. The memoized results don't outlive it (except in a
+Document), as the tokens or the parse state may differ next time.
+*/
+func (p *Parser) matchTop(n string,phaseTwo bool,tokens *scanlist.Element) ParserResult {
+	p.depth++
+	defer func() {
+		p.depth--
+		if p.tracker==nil { p.memo = nil }
+	}()
+	return p.matchLowLevel(n,phaseTwo,tokens)
+}
+func (p *Parser) matchRule(rp *ruleParser,phaseTwo bool,tokens *scanlist.Element) ParserResult {
+	if rp.jump1!=nil { return p.matchJump(rp,phaseTwo,tokens) }
 	r1 := rp.phase1.Parse(p,tokens,nil)
 	if r1.Result != RESULT_OK { return r1 }
 	if !phaseTwo { return r1 }
 	r2 := LStar{rp.phase2}.Parse(p,r1.Next,r1.Data)
 	return r2
 }
+
+// Like matchLowLevel, but uses the jump tables.
+func (p *Parser) matchJump(rp *ruleParser,phaseTwo bool,tokens *scanlist.Element) ParserResult {
+	r1 := rp.jump1.get(tokens.SafeToken()).Parse(p,tokens,nil)
+	if r1.Result != RESULT_OK { return r1 }
+	if !phaseTwo { return r1 }
+	
+	// Same as LStar{rp.phase2}.
+	opr := ResultOk(r1.Next,r1.Data)
+	for {
+		m := p.cstMark()
+		npr := rp.jump2.get(opr.Next.SafeToken()).Parse(p,opr.Next,opr.Data)
+		switch npr.Result {
+		case RESULT_FAILED:
+			p.cstReset(m)
+			return opr
+		case RESULT_FAILED_CUT: return npr
+		}
+		opr = npr
+	}
+}
 func (p *Parser) Match(n string,tokens *scanlist.Element) ParserResult {
 	return p.matchLowLevel(n,true,tokens)
 }
@@ -43,6 +43,8 @@ func Textify(r rune) string {
 	case scanner.String: return "<<String>>"
 	case scanner.RawString: return "<<RawString>>"
 	case scanner.Comment: return "<<Comment>>"
+	case scanlist.INCLUDE_ERROR: return "<<IncludeError>>"
+	case scanlist.LEX_ERROR: return "<<LexError>>"
 	}
 	if r>0 { return fmt.Sprintf("'%c'",r) }
 	return fmt.Sprintf("#%d",r)
@@ -57,6 +59,7 @@ func Match(f func(rune) string,t *scanlist.Element,rs ...rune) (error,*scanlist.
 			return fmt.Errorf("Unexpected End-Of-File (EOF), expected %s",f(r)),t
 		}
 		if t.Token!=r {
+			if t.Token==scanlist.LEX_ERROR { return fmt.Errorf("Lexical error: %s",t.TokenText),t }
 			if f==nil { return unexpected_syntax,t }
 			return fmt.Errorf("Unexpected %s, expected %s",f(t.Token),f(r)),t
 		}
@@ -0,0 +1,262 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "runtime"
+import "sort"
+import "fmt"
+
+const (
+	REPAIR_INSERT = uint(iota)
+	REPAIR_DELETE
+	REPAIR_SUBSTITUTE
+)
+
+// A text edit, that an editor can apply: replace Length bytes at Offset with Text.
+type FixIt struct{
+	Offset,Length int
+	Text string
+}
+
+// A repair for a syntax error.
+type Suggestion struct{
+	Kind uint // REPAIR_*
+	Token *scanlist.Element // the token to insert before, to delete or to replace; nil at the end of the input
+	New *scanlist.Element // the inserted or substituted token
+	Message string // like "insert ';' before 'while'"
+	Pos scanner.Position
+	Fix FixIt
+}
+func (s Suggestion) String() string { return fmt.Sprint(s.Pos,": ",s.Message) }
+
+// Placeholder texts for token kinds, that have no fixed text.
+var repairTexts = map[rune]string{
+	scanner.Ident: "x",
+	scanner.Int: "0",
+	scanner.Float: "0.0",
+	scanner.Char: "' '",
+	scanner.String: `""`,
+	scanner.RawString: "``",
+}
+
+// How far a repaired parse must look past the failure point, if it fails again.
+const repairLookahead = 3
+
+/*
+Searches for single-token insertions, deletions or substitutions, that make
+Match(n,tokens) succeed, or at least let it look repairLookahead tokens beyond
+the failure point (the furthest token, it has looked at). Only positions in a
+small window before the failure point are tried, with the tokens, the grammar
+refers to. Returns up to max suggestions, best first, or nil, if the input
+parses.
+*/
+func (p *Parser) Repair(n string,tokens *scanlist.Element,max int) []Suggestion {
+	var toks []*scanlist.Element
+	for t := tokens; t!=nil; t = t.Next() { toks = append(toks,t) }
+	
+	ok,f := p.repairMatch(n,tokens,false)
+	if ok { return nil }
+	
+	cands := p.repairCandidates(toks)
+	type scored struct{
+		s Suggestion
+		progress int
+	}
+	var found []scored
+	try := func(k int,kind uint,nt *scanlist.Element) {
+		ok,progress := p.repairMatch(n,repairApply(toks,k,kind,nt),true)
+		// Map the progress back to the original list.
+		switch {
+		case kind==REPAIR_INSERT && progress>k: progress--
+		case kind==REPAIR_DELETE && progress>=k: progress++
+		}
+		if ok {
+			if progress<=f && progress<len(toks) { return }
+			if progress>=len(toks) { progress = len(toks)+repairLookahead }
+		} else if progress<f+repairLookahead && progress<len(toks) {
+			return
+		}
+		found = append(found,scored{p.suggestion(toks,k,kind,nt),progress})
+	}
+	for k := f+1; k>=0 && k>=f-2; k-- {
+		if k>len(toks) { continue }
+		if k<len(toks) { try(k,REPAIR_DELETE,nil) }
+		for _,c := range cands {
+			try(k,REPAIR_INSERT,c)
+			if k<len(toks) && (c.Token!=toks[k].Token || c.TokenText!=toks[k].TokenText) { try(k,REPAIR_SUBSTITUTE,c) }
+		}
+	}
+	
+	// The best repairs get furthest; insertions are preferred over deletions over substitutions.
+	sort.SliceStable(found,func(i,j int) bool {
+		if found[i].progress!=found[j].progress { return found[i].progress>found[j].progress }
+		return found[i].s.Kind<found[j].s.Kind
+	})
+	if len(found)>max { found = found[:max] }
+	sugs := make([]Suggestion,len(found))
+	for i,s := range found { sugs[i] = s.s }
+	return sugs
+}
+
+/*
+Matches n on a watched copy of tokens, using a fork of p, so the parse state of
+p is left alone. Returns, whether it succeeded, and the index of the furthest
+token, the parser has looked at (on success, the index of the next token).
+
+If trial is set, a runtime error (like a Pfunc, that chokes on a repaired
+input) counts as a failure. Other panics, like "rule not defined", are errors
+in the grammar and are passed on.
+*/
+func (p *Parser) repairMatch(n string,tokens *scanlist.Element,trial bool) (ok bool,furthest int) {
+	if trial {
+		defer func() {
+			if e := recover(); e!=nil {
+				if _,rt := e.(runtime.Error); !rt { panic(e) }
+				ok = false
+			}
+		}()
+	}
+	list := scanlist.Watch(tokens,func(i int) { if i>furthest { furthest = i } })
+	res := p.Fork().Match(n,list)
+	if !res.Ok() { return false,furthest }
+	furthest = 0
+	for t := list; t!=res.Next && t!=nil; t = t.Next() { furthest++ }
+	return true,furthest
+}
+
+// Builds the token list with the repair applied at k.
+func repairApply(toks []*scanlist.Element,k int,kind uint,nt *scanlist.Element) *scanlist.Element {
+	var tail *scanlist.Element
+	if k<len(toks) { tail = toks[k] }
+	switch kind {
+	case REPAIR_INSERT: tail = nt.Relink(tail)
+	case REPAIR_DELETE: tail = tail.Next()
+	case REPAIR_SUBSTITUTE: tail = nt.Relink(tail.Next())
+	}
+	for i := k-1; i>=0; i-- { tail = toks[i].Relink(tail) }
+	return tail
+}
+
+func (p *Parser) suggestion(toks []*scanlist.Element,k int,kind uint,nt *scanlist.Element) (s Suggestion) {
+	s.Kind = kind
+	s.New = nt
+	if k<len(toks) {
+		s.Token = toks[k]
+		s.Pos = toks[k].Start
+	} else if len(toks)>0 {
+		s.Pos = toks[len(toks)-1].Pos
+	}
+	quote := func(t *scanlist.Element) string { return "'"+t.TokenText+"'" }
+	switch kind {
+	case REPAIR_INSERT:
+		if s.Token==nil {
+			s.Message = fmt.Sprintf("insert %s at the end of the input",quote(nt))
+			s.Fix = FixIt{s.Pos.Offset,0," "+nt.TokenText}
+		} else {
+			s.Message = fmt.Sprintf("insert %s before %s",quote(nt),quote(s.Token))
+			s.Fix = FixIt{s.Pos.Offset,0,nt.TokenText+" "}
+		}
+	case REPAIR_DELETE:
+		s.Message = fmt.Sprintf("delete %s",quote(s.Token))
+		s.Fix = FixIt{s.Pos.Offset,len(s.Token.TokenText),""}
+	case REPAIR_SUBSTITUTE:
+		s.Message = fmt.Sprintf("replace %s with %s",quote(s.Token),quote(nt))
+		s.Fix = FixIt{s.Pos.Offset,len(s.Token.TokenText),nt.TokenText}
+	}
+	return
+}
+
+/*
+Collects the tokens, the grammar refers to (Required, RequireText, Literal,
+Switch and First declarations), as synthetic elements. As Pfuncs may refer to
+other tokens, the keywords of the TokenDict, the punctuation of the input and
+the closing brackets are added as well.
+*/
+func (p *Parser) repairCandidates(toks []*scanlist.Element) []*scanlist.Element {
+	var dict scanlist.TokenDict
+	pos := scanner.Position{}
+	if len(toks)>0 { dict,pos = toks[0].Dict,toks[0].Start }
+	rev := make(map[rune]string)
+	for s,t := range dict { rev[t] = s }
+	
+	seen := make(map[string]bool)
+	var cands []*scanlist.Element
+	add := func(t rune,text string) {
+		if text=="" {
+			switch {
+			case rev[t]!="": text = rev[t]
+			case repairTexts[t]!="": text = repairTexts[t]
+			case t>0: text = string(t)
+			default: return
+			}
+		}
+		if t==0 { t = dict.Get(text,scanner.Ident) }
+		key := fmt.Sprint(t,text)
+		if seen[key] { return }
+		seen[key] = true
+		cands = append(cands,&scanlist.Element{Token:t,TokenText:text,Pos:pos,Start:pos,Dict:dict})
+	}
+	var walk func(r ParseRule)
+	walk = func(r ParseRule) {
+		switch v := r.(type) {
+		case Required: add(v.Token,"")
+		case RequireText: add(0,v.Text)
+		case Literal: for _,c := range v { add(c,"") }
+		case First:
+			for _,t := range v.Tokens { add(t,"") }
+			walk(v.Inner)
+		case Switch:
+			for t,r := range v.Cases { add(t,""); walk(r) }
+			if v.Default!=nil { walk(v.Default) }
+		case OR: for _,r := range v { walk(r) }
+		case LSeq: for _,r := range v { walk(r) }
+		case ArraySeq: for _,r := range v { walk(r) }
+		case LStar: walk(v.Inner)
+		case LPlus: walk(v.Inner)
+		case ArrayStar: walk(v.Inner)
+		case ArrayPlus: walk(v.Inner)
+		case TokenFinishedOptional: add(v.Token,""); walk(v.Inner)
+		case Action: walk(v.Inner)
+		case Capture: walk(v.Inner)
+		case InMode: walk(v.Inner)
+		}
+	}
+	for _,n := range p.Rules() {
+		rp := p.rules[n]
+		for _,r := range rp.phase1 { walk(r) }
+		for _,r := range rp.phase2 { walk(r) }
+	}
+	for s,t := range dict { add(t,s) }
+	for _,t := range toks {
+		if t.Token>0 { add(t.Token,t.TokenText) }
+	}
+	add(')',"")/*(*/
+	add(']',"")/*[*/
+	add('}',"")/*{*/
+	sort.SliceStable(cands,func(i,j int) bool { return cands[i].TokenText<cands[j].TokenText })
+	return cands
+}
@@ -0,0 +1,65 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "testing"
+
+// The trials must not touch the parse state of p.
+func TestRepairState(t *testing.T) {
+	p := new(Parser).Construct()
+	p.Define("Stmt",false,LSeq{Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+		if tokens.SafeToken()!=scanner.Ident { return ResultFail("Expected identifier",tokens.SafePos()) }
+		n,_ := p.State("seen").(int)
+		p.SetState("seen",n+1)
+		return ResultOk(tokens.Next(),nil)
+	}),Required{';',nil}})
+	p.BuildCST = true
+	sugs := p.Repair("Stmt",scan("a b"),3)
+	if len(sugs)==0 { t.Fatal("no suggestions") }
+	if v := p.State("seen"); v!=nil { t.Errorf("parse state changed: %v",v) }
+	if c := p.CST(); c!=nil && len(c.Children)!=0 { t.Errorf("CST changed: %v",names(c.Children)) }
+}
+
+func TestRepairPanics(t *testing.T) {
+	p := new(Parser).Construct()
+	p.Define("Top",false,Switch{map[rune]ParseRule{
+		// Chokes on the input.
+		'+': Pfunc(func(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+			var r []ParserResult
+			return r[tokens.Pos.Offset]
+		}),
+	},Required{scanner.Ident,nil}})
+	if sugs := p.Repair("Top",scan("1"),3); len(sugs)==0 { t.Error("no suggestions") }
+	
+	p.Define("Top",false,Required{'-',nil})
+	p.Define("Top",false,LSeq{Required{'*',nil},Delegate("Missing")})
+	defer func() {
+		if e := recover(); e!="rule not defined" { t.Errorf("got panic %v",e) }
+	}()
+	p.Repair("Top",scan("1"),3)
+	t.Error("no panic")
+}
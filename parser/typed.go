@@ -0,0 +1,249 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "text/scanner"
+import "github.com/byte-mug/semiparse/scanlist"
+import "fmt"
+
+/*
+The typed counterpart of ParserResult. On success, Value holds the result.
+On failure, the embedded ParserResult carries the error message in Data.
+*/
+type Result[T any] struct{
+	ParserResult
+	Value T
+}
+
+// Converts the typed result into an untyped one. On success, Data is set to Value.
+func (r Result[T]) Untyped() ParserResult {
+	pr := r.ParserResult
+	if pr.Result==RESULT_OK { pr.Data = r.Value }
+	return pr
+}
+
+func TypedOk[T any](next *scanlist.Element,v T) Result[T] {
+	return Result[T]{ResultOk(next,v),v}
+}
+
+// Converts an unsuccessful ParserResult into a typed one.
+func TypedFail[T any](pr ParserResult) Result[T] {
+	return Result[T]{ParserResult:pr}
+}
+
+/*
+A type-safe parse rule. Every Rule[T] is a ParseRule as well, so it can be
+passed to Define() and mixed with the untyped combinators.
+*/
+type Rule[T any] func(p *Parser,tokens *scanlist.Element) Result[T]
+func (r Rule[T]) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	return r(p,tokens).Untyped()
+}
+
+/*
+Wraps an untyped rule, such as a Delegate. If the rule returns something,
+that is not a T, the match fails with RESULT_FAILED_CUT instead of panicing.
+*/
+func Lift[T any](r ParseRule) Rule[T] {
+	return func(p *Parser,tokens *scanlist.Element) Result[T] {
+		pr := r.Parse(p,tokens,nil)
+		if pr.Result!=RESULT_OK { return TypedFail[T](pr) }
+		v,ok := pr.Data.(T)
+		if !ok {
+			var z T
+			return TypedFail[T](ResultFailCut(fmt.Sprintf("Type mismatch: got %T, expected %T",pr.Data,z),tokens.SafePos()))
+		}
+		return Result[T]{pr,v}
+	}
+}
+
+// Typed version of Delegate.
+func DelegateT[T any](name string) Rule[T] {
+	return Lift[T](Delegate(name))
+}
+
+// Typed version of Required{t,Textify}, yields the token text.
+func Token(t rune) Rule[string] {
+	return func(p *Parser,tokens *scanlist.Element) Result[string] {
+		err,n := Match(Textify,tokens,t)
+		if err!=nil { return TypedFail[string](ResultFail(fmt.Sprint(err),tokens.SafePos())) }
+		return TypedOk(n,tokens.SafeTokenText())
+	}
+}
+
+// Typed version of the element itself, yields the token.
+func Any() Rule[*scanlist.Element] {
+	return func(p *Parser,tokens *scanlist.Element) Result[*scanlist.Element] {
+		if tokens==nil { return TypedFail[*scanlist.Element](ResultFail("Unexpected End-Of-File (EOF)",scanner.Position{})) }
+		return TypedOk(tokens.Next(),tokens)
+	}
+}
+
+type Pair[A,B any] struct{
+	First  A
+	Second B
+}
+
+type Triple[A,B,C any] struct{
+	First  A
+	Second B
+	Third  C
+}
+
+// A B => Pair[A,B]
+func Seq2[A,B any](a Rule[A], b Rule[B]) Rule[Pair[A,B]] {
+	return func(p *Parser,tokens *scanlist.Element) Result[Pair[A,B]] {
+		ra := a(p,tokens)
+		if !ra.Ok() { return TypedFail[Pair[A,B]](ra.ParserResult) }
+		rb := b(p,ra.Next)
+		if !rb.Ok() { return TypedFail[Pair[A,B]](rb.ParserResult) }
+		return TypedOk(rb.Next,Pair[A,B]{ra.Value,rb.Value})
+	}
+}
+
+// A B C => Triple[A,B,C]
+func Seq3[A,B,C any](a Rule[A], b Rule[B], c Rule[C]) Rule[Triple[A,B,C]] {
+	return func(p *Parser,tokens *scanlist.Element) Result[Triple[A,B,C]] {
+		ra := a(p,tokens)
+		if !ra.Ok() { return TypedFail[Triple[A,B,C]](ra.ParserResult) }
+		rb := b(p,ra.Next)
+		if !rb.Ok() { return TypedFail[Triple[A,B,C]](rb.ParserResult) }
+		rc := c(p,rb.Next)
+		if !rc.Ok() { return TypedFail[Triple[A,B,C]](rc.ParserResult) }
+		return TypedOk(rc.Next,Triple[A,B,C]{ra.Value,rb.Value,rc.Value})
+	}
+}
+
+// (Inner)* => []T
+func Many[T any](r Rule[T]) Rule[[]T] {
+	return func(p *Parser,tokens *scanlist.Element) Result[[]T] {
+		arr := []T{}
+		for {
+			m := p.cstMark()
+			nr := r(p,tokens)
+			switch nr.Result {
+			case RESULT_FAILED:
+				p.cstReset(m)
+				return TypedOk(tokens,arr)
+			case RESULT_FAILED_CUT: return TypedFail[[]T](nr.ParserResult)
+			}
+			arr = append(arr,nr.Value)
+			tokens = nr.Next
+		}
+	}
+}
+
+// (Inner)+ => []T
+func Many1[T any](r Rule[T]) Rule[[]T] {
+	m := Many(r)
+	return func(p *Parser,tokens *scanlist.Element) Result[[]T] {
+		nr := r(p,tokens)
+		if !nr.Ok() { return TypedFail[[]T](nr.ParserResult) }
+		rest := m(p,nr.Next)
+		if !rest.Ok() { return rest }
+		return TypedOk(rest.Next,append([]T{nr.Value},rest.Value...))
+	}
+}
+
+// Inner (Sep Inner)* => []T
+func SepBy1[T,S any](r Rule[T], sep Rule[S]) Rule[[]T] {
+	return func(p *Parser,tokens *scanlist.Element) Result[[]T] {
+		nr := r(p,tokens)
+		if !nr.Ok() { return TypedFail[[]T](nr.ParserResult) }
+		arr := []T{nr.Value}
+		tokens = nr.Next
+		for {
+			m := p.cstMark()
+			sr := sep(p,tokens)
+			switch sr.Result {
+			case RESULT_FAILED:
+				p.cstReset(m)
+				return TypedOk(tokens,arr)
+			case RESULT_FAILED_CUT: return TypedFail[[]T](sr.ParserResult)
+			}
+			nr = r(p,sr.Next)
+			if !nr.Ok() { return TypedFail[[]T](nr.ParserResult) }
+			arr = append(arr,nr.Value)
+			tokens = nr.Next
+		}
+	}
+}
+
+// (Inner)? => *T or nil
+func Optional[T any](r Rule[T]) Rule[*T] {
+	return func(p *Parser,tokens *scanlist.Element) Result[*T] {
+		m := p.cstMark()
+		nr := r(p,tokens)
+		switch nr.Result {
+		case RESULT_FAILED:
+			p.cstReset(m)
+			return TypedOk[*T](tokens,nil)
+		case RESULT_FAILED_CUT: return TypedFail[*T](nr.ParserResult)
+		}
+		v := nr.Value
+		return TypedOk(nr.Next,&v)
+	}
+}
+
+// Converts the result of Inner using f.
+func Map[A,B any](r Rule[A], f func(A) B) Rule[B] {
+	return func(p *Parser,tokens *scanlist.Element) Result[B] {
+		nr := r(p,tokens)
+		if !nr.Ok() { return TypedFail[B](nr.ParserResult) }
+		return TypedOk(nr.Next,f(nr.Value))
+	}
+}
+
+// Typed version of OR.
+func Alt[T any](rs ...Rule[T]) Rule[T] {
+	return func(p *Parser,tokens *scanlist.Element) (opr Result[T]) {
+		fail := false
+		for _,r := range rs {
+			m := p.cstMark()
+			nr := r(p,tokens)
+			switch nr.Result {
+			case RESULT_OK,RESULT_FAILED_CUT: return nr
+			}
+			p.cstReset(m)
+			opr = nr
+			fail = true
+		}
+		if fail { return }
+		return TypedFail[T](ResultFail("no rules!",tokens.SafePos()))
+	}
+}
+
+/*
+A typed left-recursive rule, for use with Define(n,true,...). If the
+left element is not a L, the match fails with RESULT_FAILED_CUT.
+*/
+type LeftRule[L,T any] func(p *Parser,tokens *scanlist.Element, left L) Result[T]
+func (r LeftRule[L,T]) Parse(p *Parser,tokens *scanlist.Element, left interface{}) ParserResult {
+	l,ok := left.(L)
+	if !ok {
+		return ResultFailCut(fmt.Sprintf("Type mismatch: got %T, expected %T",left,l),tokens.SafePos())
+	}
+	return r(p,tokens,l).Untyped()
+}
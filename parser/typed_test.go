@@ -0,0 +1,112 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package parser
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "strconv"
+import "fmt"
+import "testing"
+
+func typedNum() Rule[int] {
+	return Map(Token(scanner.Int),func(s string) int { n,_ := strconv.Atoi(s); return n })
+}
+
+// A rule, that fails with a cut after a '!'.
+func typedCut() Rule[string] {
+	return func(p *Parser,tokens *scanlist.Element) Result[string] {
+		if tokens.SafeToken()=='!' { return TypedFail[string](ResultFailCut("cut",tokens.SafePos())) }
+		return Token(scanner.Ident)(p,tokens)
+	}
+}
+
+// Returns the result of r on src as "result value next" (or "result message").
+func typed[T any](p *Parser,r Rule[T],src string) string {
+	res := r(p,scan(src))
+	if !res.Ok() { return fmt.Sprint(res.Result," ",res.Data) }
+	return fmt.Sprint(res.Result," ",res.Value," ",res.Next.SafeTokenText())
+}
+
+func TestTypedResult(t *testing.T) {
+	r := TypedOk[int](nil,3)
+	r.Data = "stale"
+	if u := r.Untyped(); u.Data!=3 { t.Errorf("Untyped: %v",u.Data) }
+	f := TypedFail[int](ResultFail("msg",scanner.Position{}))
+	if u := f.Untyped(); u.Ok() || u.Data!="msg" { t.Errorf("Untyped: %v",u.Data) }
+	
+	p := new(Parser).Construct()
+	p.Define("Num",false,typedNum())
+	p.Define("Word",false,Required{scanner.Ident,nil})
+	p.Define("Pair",false,Seq2(DelegateT[int]("Num"),DelegateT[string]("Word")))
+	if got,want := typed(p,DelegateT[int]("Num"),"12 x"),"0 12 x"; got!=want { t.Errorf("DelegateT: got %q, want %q",got,want) }
+	if got,want := typed(p,DelegateT[int]("Word"),"x"),"2 Type mismatch: got string, expected int"; got!=want { t.Errorf("Lift: got %q, want %q",got,want) }
+	if got,want := typed(p,DelegateT[int]("Num"),"x"),"1 Unexpected <<Ident>>, expected <<Int>>"; got!=want { t.Errorf("Lift: got %q, want %q",got,want) }
+	if r := p.Match("Pair",scan("1 a")); !r.Ok() || fmt.Sprint(r.Data)!="{1 a}" { t.Errorf("Define: %v",r.Data) }
+}
+
+func TestTypedCombinators(t *testing.T) {
+	p := new(Parser).Construct()
+	num,id := typedNum(),Token(scanner.Ident)
+	comma := Token(',')
+	for _,c := range []struct{ name string; r func(string) string; src,want string }{
+		{"Token", func(s string) string { return typed(p,id,s) }, "a b", "0 a b"},
+		{"Token", func(s string) string { return typed(p,id,s) }, "1", "1 Unexpected <<Int>>, expected <<Ident>>"},
+		{"Any", func(s string) string { return typed(p,Map(Any(),func(e *scanlist.Element) string { return e.TokenText }),s) }, "+ 1", "0 + 1"},
+		{"Any", func(s string) string { return typed(p,Any(),s) }, "", "1 Unexpected End-Of-File (EOF)"},
+		{"Seq2", func(s string) string { return typed(p,Seq2(id,num),s) }, "a 1 x", "0 {a 1} x"},
+		{"Seq2", func(s string) string { return typed(p,Seq2(id,num),s) }, "a b", "1 Unexpected <<Ident>>, expected <<Int>>"},
+		{"Seq3", func(s string) string { return typed(p,Seq3(id,comma,num),s) }, "a , 2", "0 {a , 2} "},
+		{"Seq3", func(s string) string { return typed(p,Seq3(id,comma,num),s) }, "a , b", "1 Unexpected <<Ident>>, expected <<Int>>"},
+		{"Many", func(s string) string { return typed(p,Many(num),s) }, "1 2 3 x", "0 [1 2 3] x"},
+		{"Many", func(s string) string { return typed(p,Many(num),s) }, "x", "0 [] x"},
+		{"Many", func(s string) string { return typed(p,Many(typedCut()),s) }, "a b ! c", "2 cut"},
+		{"Many1", func(s string) string { return typed(p,Many1(num),s) }, "1 2", "0 [1 2] "},
+		{"Many1", func(s string) string { return typed(p,Many1(num),s) }, "x", "1 Unexpected <<Ident>>, expected <<Int>>"},
+		{"SepBy1", func(s string) string { return typed(p,SepBy1(num,comma),s) }, "1 , 2 , 3 x", "0 [1 2 3] x"},
+		{"SepBy1", func(s string) string { return typed(p,SepBy1(num,comma),s) }, "1 2", "0 [1] 2"},
+		{"SepBy1", func(s string) string { return typed(p,SepBy1(num,comma),s) }, "1 , x", "1 Unexpected <<Ident>>, expected <<Int>>"},
+		{"Optional", func(s string) string { return typed(p,Map(Optional(num),func(n *int) string { if n==nil { return "nil" }; return fmt.Sprint(*n) }),s) }, "5", "0 5 "},
+		{"Optional", func(s string) string { return typed(p,Map(Optional(num),func(n *int) bool { return n==nil }),s) }, "x", "0 true x"},
+		{"Optional", func(s string) string { return typed(p,Optional(typedCut()),s) }, "!", "2 cut"},
+		{"Alt", func(s string) string { return typed(p,Alt(Map(num,strconv.Itoa),id),s) }, "x", "0 x "},
+		{"Alt", func(s string) string { return typed(p,Alt(typedCut(),Token('!')),s) }, "!", "2 cut"},
+		{"Alt", func(s string) string { return typed(p,Alt(Map(num,strconv.Itoa),id),s) }, "+", "1 Unexpected '+', expected <<Ident>>"},
+		{"Alt", func(s string) string { return typed(p,Alt[int](),s) }, "1", "1 no rules!"},
+	} {
+		if got := c.r(c.src); got!=c.want { t.Errorf("%s %q: got %q, want %q",c.name,c.src,got,c.want) }
+	}
+}
+
+func TestLeftRule(t *testing.T) {
+	p := new(Parser).Construct()
+	p.Define("Sum",false,typedNum())
+	p.Define("Sum",true,LeftRule[int,int](func(p *Parser,tokens *scanlist.Element, left int) Result[int] {
+		return Map(Seq2(Token('+'),typedNum()),func(x Pair[string,int]) int { return left+x.Second })(p,tokens)
+	}))
+	p.Define("Bad",false,Required{scanner.Ident,nil})
+	p.Define("Bad",true,LeftRule[int,int](func(p *Parser,tokens *scanlist.Element, left int) Result[int] { return TypedOk(tokens.Next(),left) }))
+	if r := p.Match("Sum",scan("1 + 2 + 3")); !r.Ok() || r.Data!=6 { t.Errorf("Sum: %v",r.Data) }
+	if r := p.Match("Bad",scan("a b")); r.Result!=RESULT_FAILED_CUT || r.Data!="Type mismatch: got string, expected int" { t.Errorf("Bad: %v %v",r.Result,r.Data) }
+}
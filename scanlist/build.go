@@ -0,0 +1,148 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "text/scanner"
+import "strings"
+import "unicode/utf8"
+
+/*
+A token for FromTokens() and Builder. Pos is the position of its first
+character. If Token is 0, it is derived from Text, like a BaseScanner would.
+*/
+type Token struct{
+	Token rune
+	Text string
+	Pos scanner.Position
+}
+
+// Returns the position after text, which starts at p.
+func advance(p scanner.Position,text string) scanner.Position {
+	p.Offset += len(text)
+	if i := strings.LastIndexByte(text,'\n'); i>=0 {
+		p.Line += strings.Count(text,"\n")
+		p.Column = 1
+		text = text[i+1:]
+	}
+	p.Column += utf8.RuneCountInString(text)
+	return p
+}
+
+// Returns the element of t. Like with a BaseScanner, Pos is the end of the token.
+func (t Token) element(dict TokenDict) *Element {
+	r := t.Token
+	if r==0 {
+		var s scanner.Scanner
+		s.Init(strings.NewReader(t.Text))
+		s.Error = func(*scanner.Scanner,string) {}
+		r = dict.Get(t.Text,s.Scan())
+	}
+	return &Element{Token:r,TokenText:t.Text,Pos:advance(t.Pos,t.Text),Start:t.Pos,Dict:dict}
+}
+
+// Returns a list of the tokens ts.
+func FromTokens(ts []Token) *Element {
+	var e *Element
+	for i := len(ts)-1; i>=0; i-- {
+		n := ts[i].element(nil)
+		n.e = e
+		e = n
+	}
+	return e
+}
+
+type appended struct{
+	orig *Element
+	tail *Element
+}
+func (a *appended) Next() *Element {
+	n := a.orig.Next()
+	if n==nil { return a.tail }
+	return n.RelinkLazy(&appended{n,a.tail})
+}
+
+// Returns a (lazy) copy of the list e, followed by the list tail.
+func (e *Element) Append(tail *Element) *Element {
+	if e==nil { return tail }
+	return e.RelinkLazy(&appended{e,tail})
+}
+
+/*
+Builds synthetic token lists. Tokens get consecutive positions, separated by a
+space (or a newline, see Newline()), unless they are added with AddAt().
+
+	l := new(scanlist.Builder).Add(scanner.Ident,"a").Add('+',"+").Text("b*2").List()
+*/
+type Builder struct{
+	Dict TokenDict // The keywords; the Token of Text() and of tokens with Token 0.
+	Filename string
+	pos scanner.Position
+	elems []*Element
+}
+
+func (b *Builder) next() scanner.Position {
+	if b.pos.Line==0 { b.pos = scanner.Position{Filename:b.Filename,Line:1,Column:1} }
+	return b.pos
+}
+
+// Adds a token at the next position.
+func (b *Builder) Add(t rune,text string) *Builder {
+	return b.AddAt(t,text,b.next())
+}
+
+/*
+Adds a token at the position pos. The next position is the one after the
+token, plus a space.
+*/
+func (b *Builder) AddAt(t rune,text string,pos scanner.Position) *Builder {
+	e := Token{t,text,pos}.element(b.Dict)
+	if n := len(b.elems); n>0 { b.elems[n-1].e = e }
+	b.elems = append(b.elems,e)
+	b.pos = advance(e.Pos," ")
+	return b
+}
+
+// Adds the tokens of src, as scanned by a BaseScanner with Dict.
+func (b *Builder) Text(src string) *Builder {
+	p := b.next()
+	for e := ScanWith(strings.NewReader(src),p.Filename,b.Dict); e!=nil; e = e.Next() {
+		b.AddAt(e.Token,e.TokenText,advance(p,src[:e.Start.Offset]))
+	}
+	return b
+}
+
+// Moves the next position to the start of the next line.
+func (b *Builder) Newline() *Builder {
+	p := b.next()
+	if len(b.elems)>0 { p = b.elems[len(b.elems)-1].Pos }
+	b.pos = advance(p,"\n")
+	return b
+}
+
+// Returns the list of the added tokens.
+func (b *Builder) List() *Element {
+	if len(b.elems)==0 { return nil }
+	return b.elems[0]
+}
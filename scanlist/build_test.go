@@ -0,0 +1,90 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "text/scanner"
+import "strings"
+import "fmt"
+import "testing"
+
+// Returns the elements of e as "token:text@start-end", separated by spaces.
+func built(e *Element) string {
+	var s []string
+	for ; e!=nil; e = e.Next() {
+		k := scanner.TokenString(e.Token)
+		if e.Token<scanner.Comment { k = fmt.Sprint(e.Token) }
+		s = append(s,fmt.Sprintf("%s:%s@%v-%v",k,e.TokenText,e.Start,e.Pos))
+	}
+	return strings.Join(s," ")
+}
+
+func TestFromTokens(t *testing.T) {
+	at := func(l,c int) scanner.Position { return scanner.Position{Filename:"f",Line:l,Column:c} }
+	e := FromTokens([]Token{
+		{0,"abc",at(1,1)},
+		{0,"12",at(1,5)},
+		{0,`"s"`,at(2,1)},
+		{0,"+",at(2,4)},
+		{scanner.Ident,"+",at(2,5)},
+		{0,"`a\nbc`",at(3,1)},
+	})
+	want := `Ident:abc@f:1:1-f:1:4 Int:12@f:1:5-f:1:7 String:"s"@f:2:1-f:2:4 "+":+@f:2:4-f:2:5 ` +
+		"Ident:+@f:2:5-f:2:6 RawString:`a\nbc`@f:3:1-f:4:4"
+	if got := built(e); got!=want { t.Errorf("got  %q\nwant %q",got,want) }
+	if FromTokens(nil)!=nil { t.Error("empty list") }
+}
+
+func TestBuilder(t *testing.T) {
+	b := &Builder{Filename:"f",Dict:TokenDict{"if":-100}}
+	b.Add(scanner.Ident,"a").Add(0,"if").Text("b*2\n  if").Newline().Add('+',"+")
+	b.AddAt(scanner.Int,"9",scanner.Position{Filename:"g",Line:7,Column:3}).Add(0,"x")
+	want := "Ident:a@f:1:1-f:1:2 -100:if@f:1:3-f:1:5 Ident:b@f:1:6-f:1:7 \"*\":*@f:1:7-f:1:8 Int:2@f:1:8-f:1:9 " +
+		"-100:if@f:2:3-f:2:5 \"+\":+@f:3:1-f:3:2 Int:9@g:7:3-g:7:4 Ident:x@g:7:5-g:7:6"
+	if got := built(b.List()); got!=want { t.Errorf("got  %q\nwant %q",got,want) }
+	if new(Builder).List()!=nil { t.Error("empty list") }
+	
+	// The tokens are the ones of a BaseScanner.
+	src := `x = f("s", 'c', 1.5) << 2;`
+	var a,s []rune
+	for e := new(Builder).Text(src).List(); e!=nil; e = e.Next() { a = append(a,e.Token) }
+	for e := ScanWith(strings.NewReader(src),"",nil); e!=nil; e = e.Next() { s = append(s,e.Token) }
+	if fmt.Sprint(a)!=fmt.Sprint(s) { t.Errorf("got %v, want %v",a,s) }
+}
+
+func TestAppend(t *testing.T) {
+	a := new(Builder).Text("a b").List()
+	c := ScanWith(strings.NewReader("c d"),"",nil)
+	e := a.Append(c)
+	if got,want := texts(e),"a b c d"; got!=want { t.Errorf("got %q, want %q",got,want) }
+	if got := texts(a); got!="a b" { t.Errorf("the list changed to %q",got) }
+	if e==a || e.Next().Next()!=c { t.Error("not a copy, followed by the tail") }
+	if (*Element)(nil).Append(c)!=c || texts(a.Append(nil))!="a b" { t.Error("empty lists") }
+}
+
+func texts(e *Element) string {
+	var s []string
+	for ; e!=nil; e = e.Next() { s = append(s,e.TokenText) }
+	return strings.Join(s," ")
+}
@@ -0,0 +1,327 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+A C preprocessor on token lists. It expands object-like and function-like
+macros (with # and ##) and evaluates #if, #ifdef, #ifndef, #elif, #else and
+#endif. Other directives (like #include) are passed through.
+*/
+package cpp
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "strings"
+import "fmt"
+
+// A macro. Params is nil for object-like macros.
+type Macro struct{
+	Name string
+	Params []string
+	Variadic bool // the last parameter is __VA_ARGS__
+	Body []*scanlist.Element
+	Pos scanner.Position
+	items []item
+}
+
+const (
+	i_token = iota
+	i_param
+	i_string // #param
+	i_paste // ##
+)
+type item struct{
+	kind int
+	e *scanlist.Element
+	param int
+}
+
+/*
+A Preprocessor. Tokens, that result from macro expansions, get the position of
+the invocation (of the outermost macro) and an Element.Expansion.
+*/
+type Preprocessor struct{
+	Macros map[string]*Macro
+	
+	// Scans the text of pasted tokens. Defaults to scanlist.ScanWith().
+	Scan func(src string,dict scanlist.TokenDict) *scanlist.Element
+	
+	Errors []error
+}
+
+func (p *Preprocessor) errorf(pos scanner.Position,format string,args ...interface{}) {
+	p.Errors = append(p.Errors,fmt.Errorf("%v: %s",pos,fmt.Sprintf(format,args...)))
+}
+
+func (p *Preprocessor) scan(src string,dict scanlist.TokenDict) *scanlist.Element {
+	if p.Scan!=nil { return p.Scan(src,dict) }
+	return scanlist.ScanWith(strings.NewReader(src),"",dict)
+}
+
+/*
+Defines a macro, like #define. def is the name and the parameters, if any:
+
+	p.Define("DEBUG","1")
+	p.Define("MAX(a,b)","((a)>(b)?(a):(b))")
+*/
+func (p *Preprocessor) Define(def, body string) {
+	var line []*scanlist.Element
+	for e := p.scan(def+" "+body,nil); e!=nil; e = e.Next() { line = append(line,e) }
+	p.define(line)
+}
+
+// Removes the macro name, like #undef.
+func (p *Preprocessor) Undefine(name string) {
+	delete(p.Macros,name)
+}
+
+func isIdent(s string) bool {
+	for i,c := range s {
+		if !(c=='_' || c>='a' && c<='z' || c>='A' && c<='Z' || i>0 && c>='0' && c<='9') { return false }
+	}
+	return s!=""
+}
+
+// Reports, whether b directly follows a.
+func adjacent(a, b *scanlist.Element) bool {
+	return a.Start.Filename==b.Start.Filename && scanlist.EndOffset(a)==b.Start.Offset
+}
+
+// Returns the length of the operator ## at l[i] (one or two tokens), or 0.
+func pasteOp(l []*scanlist.Element,i int) int {
+	if l[i].TokenText=="##" { return 1 }
+	if l[i].Token=='#' && i+1<len(l) && l[i+1].Token=='#' && adjacent(l[i],l[i+1]) { return 2 }
+	return 0
+}
+
+// Defines a macro from the tokens of a #define line (without "#define").
+func (p *Preprocessor) define(line []*scanlist.Element) {
+	if len(line)==0 || !isIdent(line[0].TokenText) {
+		pos := scanner.Position{}
+		if len(line)>0 { pos = line[0].Start }
+		p.errorf(pos,"macro name missing")
+		return
+	}
+	m := &Macro{Name:line[0].TokenText,Pos:line[0].Start}
+	body := line[1:]
+	if len(body)>0 && body[0].Token=='(' && adjacent(line[0],body[0]) {
+		m.Params = []string{}
+		i := 1
+		for ; i<len(body) && body[i].Token!=')'; i++ {
+			t := body[i]
+			switch {
+			case t.Token==',':
+			case isIdent(t.TokenText): m.Params = append(m.Params,t.TokenText)
+			case t.TokenText=="...":
+				m.Params,m.Variadic = append(m.Params,"__VA_ARGS__"),true
+			case t.Token=='.' && i+2<len(body) && body[i+1].Token=='.' && body[i+2].Token=='.':
+				m.Params,m.Variadic = append(m.Params,"__VA_ARGS__"),true
+				i += 2
+			default:
+				p.errorf(t.Start,"unexpected '%s' in the parameters of %s",t.TokenText,m.Name)
+				return
+			}
+		}
+		if i==len(body) {
+			p.errorf(line[0].Start,"missing ')' in the parameters of %s",m.Name)
+			return
+		}
+		body = body[i+1:]
+	}
+	m.Body = body
+	param := func(e *scanlist.Element) int {
+		for i,n := range m.Params { if n==e.TokenText { return i } }
+		return -1
+	}
+	for i := 0; i<len(body); i++ {
+		if n := pasteOp(body,i); n>0 {
+			m.items = append(m.items,item{i_paste,body[i],0})
+			i += n-1
+			continue
+		}
+		if m.Params!=nil && body[i].Token=='#' && i+1<len(body) && param(body[i+1])>=0 {
+			m.items = append(m.items,item{i_string,body[i],param(body[i+1])})
+			i++
+			continue
+		}
+		if m.Params!=nil && param(body[i])>=0 {
+			m.items = append(m.items,item{i_param,body[i],param(body[i])})
+			continue
+		}
+		m.items = append(m.items,item{i_token,body[i],0})
+	}
+	if o := p.Macros[m.Name]; o!=nil && !o.same(m) { p.errorf(m.Pos,"%s redefined",m.Name) }
+	if p.Macros==nil { p.Macros = make(map[string]*Macro) }
+	p.Macros[m.Name] = m
+}
+
+func (m *Macro) same(o *Macro) bool {
+	if m.Variadic!=o.Variadic || (m.Params==nil)!=(o.Params==nil) || len(m.Params)!=len(o.Params) || len(m.Body)!=len(o.Body) { return false }
+	for i := range m.Params { if m.Params[i]!=o.Params[i] { return false } }
+	for i := range m.Body { if m.Body[i].TokenText!=o.Body[i].TokenText { return false } }
+	return true
+}
+
+type cond struct{
+	active bool // the current group is processed.
+	taken bool // a group has been processed (or the enclosing group is skipped).
+	sawElse bool
+	pos scanner.Position
+}
+
+type state struct{
+	p *Preprocessor
+	in *scanlist.Element // the next input token
+	prev *scanlist.Element // the last input token
+	conds []cond
+	queue []tok // tokens of passed through directives
+	x expander
+}
+
+// Returns the preprocessed list e.
+func (p *Preprocessor) Process(e *scanlist.Element) *scanlist.Element {
+	s := &state{p:p,in:e}
+	s.x = expander{p:p,pull:s.pull}
+	return s.Next()
+}
+
+func (s *state) active() bool { return len(s.conds)==0 || s.conds[len(s.conds)-1].active }
+
+func (s *state) read() *scanlist.Element {
+	e := s.in
+	s.prev,s.in = e,e.Next()
+	return e
+}
+
+// Reports, whether the next input token starts a directive.
+func (s *state) atDirective() bool {
+	e := s.in
+	if e==nil || e.Token!='#' { return false }
+	return s.prev==nil || s.prev.Start.Line!=e.Start.Line || s.prev.Start.Filename!=e.Start.Filename
+}
+
+// Reads the rest of the line (with lines, continued by a backslash).
+func (s *state) readLine(first *scanlist.Element) (line []*scanlist.Element) {
+	cur := first.Start
+	for s.in!=nil && s.in.Start.Line==cur.Line && s.in.Start.Filename==cur.Filename {
+		e := s.read()
+		if e.Token=='\\' && s.in!=nil && s.in.Start.Line>cur.Line {
+			cur = s.in.Start
+			continue
+		}
+		line = append(line,e)
+	}
+	return
+}
+
+// Pulls the next token of the text (up to the next directive) for the expander.
+func (s *state) pull() (tok,bool) {
+	for s.in!=nil && !s.atDirective() {
+		e := s.read()
+		if s.active() { return tok{e:e},true }
+	}
+	return tok{},false
+}
+
+func (s *state) Next() *scanlist.Element {
+	for {
+		if len(s.queue)>0 {
+			t := s.queue[0]
+			s.queue = s.queue[1:]
+			return s.output(t)
+		}
+		if t,ok := s.x.next(); ok { return s.output(t) }
+		if s.in==nil {
+			for _,c := range s.conds { s.p.errorf(c.pos,"unterminated conditional") }
+			s.conds = nil
+			return nil
+		}
+		s.directive()
+	}
+}
+
+func (s *state) output(t tok) *scanlist.Element {
+	c := t.e.RelinkLazy(s)
+	if t.at!=nil { c.Start,c.Pos = t.at.Start,t.at.Pos }
+	c.Expansion = t.exp
+	return c
+}
+
+func (s *state) directive() {
+	hash := s.read()
+	line := s.readLine(hash)
+	if len(line)==0 { return }
+	name,args := line[0].TokenText,line[1:]
+	top := len(s.conds)-1
+	switch name {
+	case "if","ifdef","ifndef":
+		c := cond{taken:true,pos:hash.Start}
+		if s.active() {
+			var v bool
+			switch name {
+			case "if": v = s.eval(args,hash)!=0
+			case "ifdef": v = len(args)>0 && s.p.Macros[args[0].TokenText]!=nil
+			case "ifndef": v = len(args)==0 || s.p.Macros[args[0].TokenText]==nil
+			}
+			c.active,c.taken = v,v
+		}
+		s.conds = append(s.conds,c)
+		return
+	case "elif","else","endif":
+		if top<0 {
+			s.p.errorf(hash.Start,"#%s without #if",name)
+			return
+		}
+		c := &s.conds[top]
+		switch {
+		case name=="endif":
+			s.conds = s.conds[:top]
+		case c.sawElse:
+			s.p.errorf(hash.Start,"#%s after #else",name)
+		case c.taken:
+			c.active = false
+			c.sawElse = name=="else"
+		case name=="else":
+			c.active,c.taken,c.sawElse = true,true,true
+		default:
+			c.active = s.eval(args,hash)!=0
+			c.taken = c.active
+		}
+		return
+	}
+	if !s.active() { return }
+	switch name {
+	case "define": s.p.define(args)
+	case "undef":
+		if len(args)>0 { s.p.Undefine(args[0].TokenText) }
+	case "error": s.p.errorf(hash.Start,"#error%s",lineText(args))
+	default:
+		s.queue = append(s.queue,tok{e:hash})
+		for _,e := range line { s.queue = append(s.queue,tok{e:e}) }
+	}
+}
+
+func lineText(l []*scanlist.Element) (s string) {
+	for _,e := range l { s += " "+e.TokenText }
+	return
+}
@@ -0,0 +1,98 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cpp
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "strings"
+import "testing"
+
+func preprocess(p *Preprocessor,src string) string {
+	var out []string
+	for e := p.Process(scanlist.ScanWith(strings.NewReader(src),"t.c",nil)); e!=nil; e = e.Next() { out = append(out,e.TokenText) }
+	return strings.Join(out," ")
+}
+
+func TestPreprocessor(t *testing.T) {
+	for _,c := range []struct{
+		name,src,want,err string
+	}{
+		{"object","#define N 10\nx = N;","x = 10 ;",""},
+		{"function","#define MAX(a,b) ((a)>(b)?(a):(b))\nMAX(1,x+2)","( ( 1 ) > ( x + 2 ) ? ( 1 ) : ( x + 2 ) )",""},
+		{"no invocation","#define F(x) [x]\nF + F(1) F\n(2)","F + [ 1 ] [ 2 ]",""},
+		{"nested arguments","#define F(x,y) x|y\nF((a,b),c)","( a , b ) | c",""},
+		{"undef","#define N 1\nN\n#undef N\nN","1 N",""},
+		{"self reference","#define foo foo a\nfoo","foo a",""},
+		{"mutual reference","#define a b\n#define b a\na b","a b",""},
+		{"hide set of arguments","#define f(x) x f\nf(1)(2)","1 f ( 2 )",""},
+		{"standard example","#define x 3\n#define f(a) f(x * (a))\n#undef x\n#define x 2\n#define z z[0]\nf(y+1) + f(f(z))",
+			"f ( 2 * ( y + 1 ) ) + f ( 2 * ( f ( 2 * ( z [ 0 ] ) ) ) )",""},
+		{"stringize","#define S(x) #x\nS(  a   +b \"c\\n\" 'd')",`"a +b \"c\\n\" 'd'"`,""},
+		{"stringize unexpanded","#define N 1\n#define S(x) #x\nS(N)",`"N"`,""},
+		{"paste","#define CAT(a,b) a##b\n#define N 1\nCAT(x,1) CAT(1,2) CAT(N,N) CAT(,y)","x1 12 NN y",""},
+		{"invalid paste","#define CAT(a,b) a##b\nCAT(+,-)","+ -","pasting '+' and '-' doesn't give a valid token"},
+		{"variadic","#define V(a,...) a:__VA_ARGS__\nV(1) V(1,2,3)","1 : 1 : 2 , 3",""},
+		{"too few arguments","#define F(a,b) a\nF(1)","F ( 1 )","F expects 2 arguments, got 1"},
+		{"too many arguments","#define Z() z\nZ() Z(1)","z Z ( 1 )","Z expects 0 arguments, got 1"},
+		{"unterminated invocation","#define F(a) a\nF(1","F ( 1","unterminated invocation of F"},
+		{"if","#if 1 + 2 * 3 == 7 && !0\na\n#else\nb\n#endif","a",""},
+		{"elif","#define A 1\n#if A > 1\nx\n#elif A == 1 && defined(A) && !defined B\ny\n#else\nz\n#endif","y",""},
+		{"ifdef","#define A\n#ifdef A\na\n#endif\n#ifndef A\nb\n#endif\n#ifdef B\nc\n#else\nd\n#endif","a d",""},
+		{"skipped groups","#if 0\n#if 1\na\n#else\nb\n#endif\nc\n#elif 1\nd\n#if 0\ne\n#elif 1\nf\n#endif\n#else\ng\n#endif\nh","d f h",""},
+		{"skipped directives","#if 0\n#error no\n#define X 1\n#if 1/0\n#endif\n#else\nX\n#endif","X",""},
+		{"taken elif","#if 1\na\n#elif 1/0\nb\n#endif","a",""},
+		{"line continuation","#define L(a) \\\n a + \\\n 1\nL(2)","2 + 1",""},
+		{"pass through","#include <a.h>\nx","# include < a . h > x",""},
+		{"else without if","#else\nx","x","#else without #if"},
+		{"else after else","#if 0\n#else\n#else\n#endif","","#else after #else"},
+		{"unterminated conditional","#if 1\nx","x","unterminated conditional"},
+		{"error","#error stop here","","#error stop here"},
+		{"missing name","#define\nx","x","macro name missing"},
+		{"bad expression","#if 1 +\nx\n#endif","","#if:"},
+		{"redefinition","#define A 1\n#define A 1\n#define A 2\nA","2","A redefined"},
+	}{
+		p := new(Preprocessor)
+		got := preprocess(p,c.src)
+		if got!=c.want { t.Errorf("%s: got %q, want %q",c.name,got,c.want) }
+		switch {
+		case c.err=="" && len(p.Errors)>0: t.Errorf("%s: %v",c.name,p.Errors)
+		case c.err!="" && (len(p.Errors)!=1 || !strings.Contains(p.Errors[0].Error(),c.err)): t.Errorf("%s: errors %v, want %q",c.name,p.Errors,c.err)
+		}
+	}
+}
+
+// Expanded tokens get the position of the invocation and their expansion.
+func TestExpansion(t *testing.T) {
+	p := new(Preprocessor)
+	p.Define("INNER","i")
+	p.Define("OUTER(x)","x INNER")
+	l := p.Process(scanlist.ScanWith(strings.NewReader("a\n  OUTER(b)"),"t.c",nil))
+	a := l
+	b := a.Next()
+	i := b.Next()
+	if a.Expansion!=nil || b.Expansion!=nil { t.Errorf("arguments and plain tokens aren't expanded") }
+	if i==nil || i.TokenText!="i" || i.Next()!=nil { t.Fatalf("got %v",i) }
+	if i.Start.Line!=2 || i.Start.Column!=3 { t.Errorf("position %v",i.Start) }
+	if x := i.Expansion; x==nil || x.Macro!="INNER" || x.Parent==nil || x.Parent.Macro!="OUTER" { t.Errorf("expansion %+v",x) }
+}
@@ -0,0 +1,191 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cpp
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "strconv"
+import "strings"
+import "fmt"
+
+var precedence = map[string]int{
+	"||":1,
+	"&&":2,
+	"|":3,
+	"^":4,
+	"&":5,
+	"==":6, "!=":6,
+	"<":7, ">":7, "<=":7, ">=":7,
+	"<<":8, ">>":8,
+	"+":9, "-":9,
+	"*":10, "/":10, "%":10,
+}
+
+// Evaluates the condition of #if or #elif.
+func (s *state) eval(line []*scanlist.Element,hash *scanlist.Element) int64 {
+	var ts []tok
+	for i := 0; i<len(line); i++ {
+		e := line[i]
+		if e.TokenText!="defined" {
+			ts = append(ts,tok{e:e})
+			continue
+		}
+		paren := i+1<len(line) && line[i+1].Token=='('
+		if paren { i++ }
+		v := "0"
+		if i+1<len(line) && s.p.Macros[line[i+1].TokenText]!=nil { v = "1" }
+		i++
+		if paren { i++ }
+		ts = append(ts,tok{e:&scanlist.Element{Token:scanner.Int,TokenText:v,Pos:e.Pos,Start:e.Start}})
+	}
+	ts = s.p.expandAll(ts)
+	
+	// Operators, which have been scanned as single characters, are combined.
+	var texts []string
+	for i := 0; i<len(ts); i++ {
+		t := ts[i].e.TokenText
+		if i+1<len(ts) && len(t)==1 && adjacent(ts[i].e,ts[i+1].e) {
+			if _,ok := precedence[t+ts[i+1].e.TokenText]; ok {
+				t += ts[i+1].e.TokenText
+				i++
+			}
+		}
+		texts = append(texts,t)
+	}
+	v := &evaluator{toks:texts}
+	r := v.cond(true)
+	if v.err==nil && v.i<len(v.toks) { v.err = fmt.Errorf("unexpected '%s'",v.toks[v.i]) }
+	if v.err!=nil {
+		s.p.errorf(hash.Start,"#if: %v",v.err)
+		return 0
+	}
+	return r
+}
+
+// An integer constant expression.
+type evaluator struct{
+	toks []string
+	i int
+	err error
+}
+
+func (v *evaluator) peek() string {
+	if v.i<len(v.toks) { return v.toks[v.i] }
+	return ""
+}
+func (v *evaluator) fail(format string,args ...interface{}) int64 {
+	if v.err==nil { v.err = fmt.Errorf(format,args...) }
+	return 0
+}
+
+// c ? a : b. Errors (like a division by zero) only count, if live is set.
+func (v *evaluator) cond(live bool) int64 {
+	c := v.binary(1,live)
+	if v.peek()!="?" { return c }
+	v.i++
+	a := v.cond(live && c!=0)
+	if v.peek()!=":" { return v.fail("missing ':'") }
+	v.i++
+	b := v.cond(live && c==0)
+	if c!=0 { return a }
+	return b
+}
+
+func (v *evaluator) binary(min int,live bool) int64 {
+	l := v.unary(live)
+	for {
+		op := v.peek()
+		prec,ok := precedence[op]
+		if !ok || prec<min { return l }
+		v.i++
+		rlive := live
+		switch op {
+		case "&&": rlive = live && l!=0
+		case "||": rlive = live && l==0
+		}
+		r := v.binary(prec+1,rlive)
+		l = v.apply(op,l,r,rlive)
+	}
+}
+
+func b2i(b bool) int64 {
+	if b { return 1 }
+	return 0
+}
+
+func (v *evaluator) apply(op string,l, r int64,live bool) int64 {
+	switch op {
+	case "||": return b2i(l!=0 || r!=0)
+	case "&&": return b2i(l!=0 && r!=0)
+	case "|": return l|r
+	case "^": return l^r
+	case "&": return l&r
+	case "==": return b2i(l==r)
+	case "!=": return b2i(l!=r)
+	case "<": return b2i(l<r)
+	case ">": return b2i(l>r)
+	case "<=": return b2i(l<=r)
+	case ">=": return b2i(l>=r)
+	case "<<": return l<<uint64(r)
+	case ">>": return l>>uint64(r)
+	case "+": return l+r
+	case "-": return l-r
+	case "*": return l*r
+	}
+	if r==0 {
+		if live { return v.fail("division by zero") }
+		return 0
+	}
+	if op=="/" { return l/r }
+	return l%r
+}
+
+func (v *evaluator) unary(live bool) int64 {
+	t := v.peek()
+	v.i++
+	switch {
+	case t=="": return v.fail("unexpected end of expression")
+	case t=="+": return v.unary(live)
+	case t=="-": return -v.unary(live)
+	case t=="!": return b2i(v.unary(live)==0)
+	case t=="~": return ^v.unary(live)
+	case t=="(":
+		r := v.cond(live)
+		if v.peek()!=")" { return v.fail("missing ')'") }
+		v.i++
+		return r
+	case t[0]=='\'':
+		s,err := strconv.Unquote(t)
+		if err!=nil || len([]rune(s))!=1 { return v.fail("invalid character constant %s",t) }
+		return int64([]rune(s)[0])
+	case t[0]>='0' && t[0]<='9':
+		n,err := strconv.ParseInt(strings.TrimRight(t,"uUlL"),0,64)
+		if err!=nil { return v.fail("invalid integer constant %s",t) }
+		return n
+	case isIdent(t):
+		return 0 // identifiers, that aren't macros
+	}
+	return v.fail("unexpected '%s'",t)
+}
@@ -0,0 +1,227 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cpp
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "strings"
+
+type hideSet map[string]bool
+
+func (h hideSet) union(o hideSet) hideSet {
+	if len(o)==0 { return h }
+	if len(h)==0 { return o }
+	n := make(hideSet,len(h)+len(o))
+	for k := range h { n[k] = true }
+	for k := range o { n[k] = true }
+	return n
+}
+func (h hideSet) intersect(o hideSet) hideSet {
+	n := make(hideSet)
+	for k := range h { if o[k] { n[k] = true } }
+	return n
+}
+
+// A token during macro expansion.
+type tok struct{
+	e *scanlist.Element // as spelled
+	hide hideSet // the macros, that must not be expanded (again)
+	exp *scanlist.Expansion
+	at *scanlist.Element // the invocation of the outermost macro; nil, if not expanded
+}
+
+/*
+Expands macros, using the hide sets of Prosser's algorithm: a token, that
+results from the expansion of a macro, never invokes that macro again.
+*/
+type expander struct{
+	p *Preprocessor
+	pending []tok
+	pull func() (tok,bool) // more input; nil, if there is none
+}
+
+// Makes sure, that pending has more than i tokens.
+func (x *expander) peek(i int) (tok,bool) {
+	for len(x.pending)<=i {
+		if x.pull==nil { return tok{},false }
+		t,ok := x.pull()
+		if !ok { return tok{},false }
+		x.pending = append(x.pending,t)
+	}
+	return x.pending[i],true
+}
+
+// Returns the next fully expanded token.
+func (x *expander) next() (tok,bool) {
+	for {
+		t,ok := x.peek(0)
+		if !ok { return t,false }
+		m := x.p.Macros[t.e.TokenText]
+		if m==nil || t.hide[m.Name] || !isIdent(t.e.TokenText) {
+			x.pending = x.pending[1:]
+			return t,true
+		}
+		if m.Params==nil {
+			x.pending = append(x.p.subst(m,nil,t,t.hide.union(hideSet{m.Name:true})),x.pending[1:]...)
+			continue
+		}
+		if lp,ok := x.peek(1); !ok || lp.e.Token!='(' {
+			x.pending = x.pending[1:]
+			return t,true
+		}
+		args,rp,n,ok := x.args(m)
+		if !ok {
+			x.pending = x.pending[1:]
+			return t,true
+		}
+		hs := t.hide.intersect(rp.hide).union(hideSet{m.Name:true})
+		x.pending = append(x.p.subst(m,args,t,hs),x.pending[n:]...)
+	}
+}
+
+// Collects the arguments of an invocation of m. n is the number of tokens up to the ')' (rp).
+func (x *expander) args(m *Macro) (args [][]tok,rp tok,n int,ok bool) {
+	var cur []tok
+	depth := 0
+	for i := 2; ; i++ {
+		t,ok := x.peek(i)
+		if !ok {
+			x.p.errorf(x.pending[0].e.Start,"unterminated invocation of %s",m.Name)
+			return nil,t,0,false
+		}
+		switch t.e.Token {
+		case '(': depth++
+		case ')':
+			if depth==0 {
+				args = append(args,cur)
+				rp,n = t,i+1
+				goto done
+			}
+			depth--
+		case ',':
+			if depth==0 && !(m.Variadic && len(args)==len(m.Params)-1) {
+				args = append(args,cur)
+				cur = nil
+				continue
+			}
+		}
+		cur = append(cur,t)
+	}
+done:
+	np := len(m.Params)
+	if np==0 && len(args)==1 && len(args[0])==0 { args = nil }
+	if m.Variadic && len(args)==np-1 { args = append(args,nil) }
+	if len(args)!=np {
+		x.p.errorf(x.pending[0].e.Start,"%s expects %d arguments, got %d",m.Name,np,len(args))
+		return nil,rp,0,false
+	}
+	return args,rp,n,true
+}
+
+// Returns the expansion of ts.
+func (p *Preprocessor) expandAll(ts []tok) (r []tok) {
+	x := &expander{p:p,pending:append([]tok(nil),ts...)}
+	for {
+		t,ok := x.next()
+		if !ok { return }
+		r = append(r,t)
+	}
+}
+
+// Returns the replacement of the invocation inv of m with hide set hs.
+func (p *Preprocessor) subst(m *Macro,args [][]tok,inv tok,hs hideSet) []tok {
+	at := inv.at
+	if at==nil { at = inv.e }
+	body := func(e *scanlist.Element) tok {
+		return tok{e:e,exp:&scanlist.Expansion{Macro:m.Name,Spelling:e.Start,Parent:inv.exp},at:at}
+	}
+	var out []tok
+	pasteAt := -1 // the index of the right operand of ##
+	lhs := false // the previous item has contributed tokens
+	for j,it := range m.items {
+		if it.kind==i_paste {
+			if lhs && len(out)>0 { pasteAt = len(out) }
+			continue
+		}
+		start := len(out)
+		switch it.kind {
+		case i_token: out = append(out,body(it.e))
+		case i_string: out = append(out,p.stringize(args[it.param],body(it.e)))
+		case i_param:
+			raw := j>0 && m.items[j-1].kind==i_paste || j+1<len(m.items) && m.items[j+1].kind==i_paste
+			if raw {
+				out = append(out,args[it.param]...)
+			} else {
+				out = append(out,p.expandAll(args[it.param])...)
+			}
+		}
+		lhs = len(out)>start
+		if pasteAt>=0 && len(out)>pasteAt {
+			pt,ok := p.paste(out[pasteAt-1],out[pasteAt])
+			if ok {
+				out[pasteAt-1] = pt
+				out = append(out[:pasteAt],out[pasteAt+1:]...)
+				lhs = true
+			}
+		}
+		pasteAt = -1
+	}
+	for i := range out { out[i].hide = out[i].hide.union(hs) }
+	return out
+}
+
+// Returns the string literal of the tokens ts.
+func (p *Preprocessor) stringize(ts []tok,at tok) tok {
+	s := new(strings.Builder)
+	s.WriteByte('"')
+	for i,t := range ts {
+		if i>0 && !adjacent(ts[i-1].e,t.e) { s.WriteByte(' ') }
+		switch t.e.Token {
+		case scanner.String,scanner.Char,scanner.RawString:
+			s.WriteString(strings.NewReplacer(`\`,`\\`,`"`,`\"`).Replace(t.e.TokenText))
+		default:
+			s.WriteString(t.e.TokenText)
+		}
+	}
+	s.WriteByte('"')
+	at.e = &scanlist.Element{Token:scanner.String,TokenText:s.String(),Pos:at.e.Pos,Start:at.e.Start,Dict:at.e.Dict}
+	return at
+}
+
+// Returns the token l##r.
+func (p *Preprocessor) paste(l, r tok) (tok,bool) {
+	text := l.e.TokenText+r.e.TokenText
+	e := p.scan(text,l.e.Dict)
+	if text=="##" { e = &scanlist.Element{Token:'#',TokenText:text} } // not a token of the scanner
+	if e==nil || e.TokenText!=text || e.Next()!=nil {
+		p.errorf(l.e.Start,"pasting '%s' and '%s' doesn't give a valid token",l.e.TokenText,r.e.TokenText)
+		return l,false
+	}
+	e = e.Relink(nil)
+	e.Pos,e.Start,e.Dict = l.e.Pos,l.e.Start,l.e.Dict
+	l.e = e
+	l.hide = l.hide.union(r.hide)
+	return l,true
+}
@@ -0,0 +1,178 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "text/scanner"
+import "io/fs"
+import "path"
+import "bytes"
+import "strings"
+import "fmt"
+
+// The token of an include directive, that failed. The TokenText is the error message.
+const INCLUDE_ERROR = rune(-1000)
+
+// Resolves the names of include directives to files.
+type IncludeResolver interface{
+	// Returns the file name, included from the file from, and its content.
+	Resolve(name, from string) (file string, src []byte, err error)
+}
+
+// An IncludeResolver, that maps names to contents.
+type MapResolver map[string]string
+func (m MapResolver) Resolve(name, from string) (string,[]byte,error) {
+	s,ok := m[name]
+	if !ok { return "",nil,fmt.Errorf("%s: file not found",name) }
+	return name,[]byte(s),nil
+}
+
+/*
+An IncludeResolver for a file system. Names are looked up relative to the
+including file first, and then in Dirs.
+*/
+type FSResolver struct{
+	FS fs.FS
+	Dirs []string
+}
+func (r *FSResolver) Resolve(name, from string) (string,[]byte,error) {
+	dirs := r.Dirs
+	if from!="" { dirs = append([]string{path.Dir(from)},dirs...) }
+	for _,d := range dirs {
+		f := path.Join(d,name)
+		if src,err := fs.ReadFile(r.FS,f); err==nil { return f,src,nil }
+	}
+	return "",nil,fmt.Errorf("%s: file not found",name)
+}
+
+/*
+The file, an element comes from. Parent is the file, that included it (at
+Pos), or nil for the main file.
+*/
+type Include struct{
+	File string
+	Pos scanner.Position
+	Parent *Include
+	rest *Element // the tokens after the directive
+}
+
+// Returns the include stack, like "b.h included from a.h:1:1, a.h included from main.c:3:1".
+func (i *Include) String() string {
+	s := []string{}
+	for ; i!=nil; i = i.Parent {
+		if i.Parent==nil { break }
+		s = append(s,fmt.Sprintf("%s included from %v",i.File,i.Pos))
+	}
+	return strings.Join(s,", ")
+}
+
+/*
+Splices the files of include directives into a token list. The tokens of an
+included file are scanned lazily, when the directive is reached.
+*/
+type Includer struct{
+	Resolver IncludeResolver
+	
+	/*
+	Recognizes a directive at e and returns the name and the tokens after it.
+	Defaults to DefaultDirective.
+	*/
+	Directive func(e *Element) (name string,after *Element,ok bool)
+	
+	// Scans an included file. Defaults to a BaseScanner with the Dict of the directive.
+	Scan func(file string,src []byte,dict TokenDict) *Element
+	
+	// The errors of all failed directives.
+	Errors []error
+}
+
+/*
+Recognizes #include "name" and #include <name>. The name between the angle
+brackets is the text of the tokens between them.
+*/
+func DefaultDirective(e *Element) (string,*Element,bool) {
+	if e.Token!='#' { return "",nil,false }
+	n := e.Next()
+	if n==nil || n.TokenText!="include" { return "",nil,false }
+	n = n.Next()
+	switch {
+	case n==nil:
+	case n.Token==scanner.String:
+		return n.TokenText[1:len(n.TokenText)-1],n.Next(),true
+	case n.Token=='<':
+		s := ""
+		for n = n.Next(); n!=nil && n.Token!='>'; n = n.Next() { s += n.TokenText }
+		if n!=nil { return s,n.Next(),true }
+	}
+	return "",nil,false
+}
+
+func (c *Includer) scan(file string,src []byte,dict TokenDict) *Element {
+	if c.Scan!=nil { return c.Scan(file,src,dict) }
+	return ScanWith(bytes.NewReader(src),file,dict)
+}
+
+type includer struct{
+	c *Includer
+	orig *Element
+	inc *Include
+}
+func (s *includer) Next() *Element {
+	return s.c.splice(s.orig.Next(),s.inc)
+}
+
+// Returns a copy of the list e (of the file file), with the included files spliced in.
+func (c *Includer) Splice(e *Element,file string) *Element {
+	return c.splice(e,&Include{File:file})
+}
+
+func (c *Includer) splice(e *Element,inc *Include) *Element {
+	dir := c.Directive
+	if dir==nil { dir = DefaultDirective }
+	for {
+		if e==nil {
+			if inc.Parent==nil { return nil }
+			e,inc = inc.rest,inc.Parent
+			continue
+		}
+		name,after,ok := dir(e)
+		if !ok { break }
+		f,src,err := c.Resolver.Resolve(name,inc.File)
+		for i := inc; err==nil && i!=nil; i = i.Parent {
+			if i.File==f { err = fmt.Errorf("include cycle: %s",f) }
+		}
+		if err!=nil {
+			err = fmt.Errorf("%v: %v",e.Start,err)
+			c.Errors = append(c.Errors,err)
+			n := &Element{Token:INCLUDE_ERROR,TokenText:err.Error(),Pos:e.Pos,Start:e.Start,Dict:e.Dict,e:after}
+			e = n
+			break
+		}
+		e,inc = c.scan(f,src,e.Dict),&Include{File:f,Pos:e.Start,Parent:inc,rest:after}
+	}
+	n := e.Relink(nil)
+	n.Include = inc
+	n.bs = &includer{c,e,inc}
+	return n
+}
@@ -0,0 +1,100 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "testing/fstest"
+import "strings"
+import "fmt"
+import "testing"
+
+type countingResolver struct{
+	IncludeResolver
+	calls []string
+}
+func (c *countingResolver) Resolve(name, from string) (string,[]byte,error) {
+	c.calls = append(c.calls,name)
+	return c.IncludeResolver.Resolve(name,from)
+}
+
+// Returns the tokens of e as "text@start" (errors as "!text"), separated by spaces.
+func included(e *Element) string {
+	var s []string
+	for ; e!=nil; e = e.Next() {
+		if e.Token==INCLUDE_ERROR { s = append(s,"!"+e.TokenText); continue }
+		s = append(s,fmt.Sprint(e.TokenText,"@",e.Start))
+	}
+	return strings.Join(s," ")
+}
+
+func TestIncludeNested(t *testing.T) {
+	r := &countingResolver{IncludeResolver:MapResolver{
+		"b.h": "b1\n #include <d.h> b2 #include \"e.h\"",
+		"d.h": "d",
+		"e.h": "",
+	}}
+	c := &Includer{Resolver:r}
+	e := c.Splice(ScanWith(strings.NewReader(`a #include "b.h" c`),"main.c",nil),"main.c")
+	if len(r.calls)!=0 || e.TokenText!="a" { t.Fatalf("not lazy: %v",r.calls) }
+	want := "a@main.c:1:1 b1@b.h:1:1 d@d.h:1:1 b2@b.h:2:17 c@main.c:1:18"
+	if got := included(e); got!=want { t.Errorf("got  %s\nwant %s",got,want) }
+	if len(c.Errors)!=0 { t.Error(c.Errors) }
+	
+	stacks := []string{"", "b.h included from main.c:1:3", "d.h included from b.h:2:2, b.h included from main.c:1:3"}
+	for i,t0 := 0,e; i<len(stacks); i,t0 = i+1,t0.Next() {
+		if got := t0.Include.String(); got!=stacks[i] { t.Errorf("%s: got %q, want %q",t0.TokenText,got,stacks[i]) }
+	}
+	
+	// A file, that only consists of an include.
+	c = &Includer{Resolver:MapResolver{"x.h": `#include "y.h"`,"y.h": "y"}}
+	if got,want := included(c.Splice(ScanWith(strings.NewReader(`#include "x.h"`),"m",nil),"m")),"y@y.h:1:1"; got!=want { t.Errorf("got %s, want %s",got,want) }
+}
+
+func TestIncludeErrors(t *testing.T) {
+	c := &Includer{Resolver:MapResolver{
+		"a.h": "a #include \"b.h\" a2",
+		"b.h": "b #include \"a.h\" b2",
+		"s.h": "#include \"s.h\"",
+	}}
+	src := `#include "a.h" #include "s.h" #include "none.h" x #include`
+	got := included(c.Splice(ScanWith(strings.NewReader(src),"m",nil),"m"))
+	want := "a@a.h:1:1 b@b.h:1:1 !b.h:1:3: include cycle: a.h b2@b.h:1:18 a2@a.h:1:18 " +
+		"!s.h:1:1: include cycle: s.h !m:1:31: none.h: file not found x@m:1:49 #@m:1:51 include@m:1:52"
+	if got!=want { t.Errorf("got  %s\nwant %s",got,want) }
+	if len(c.Errors)!=3 { t.Errorf("errors: %v",c.Errors) }
+}
+
+func TestFSResolver(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/main.c": {Data:[]byte(`#include "local.h" #include <sys.h>`)},
+		"src/local.h": {Data:[]byte(`local #include "sys.h"`)},
+		"src/sys/x.h": {Data:[]byte(`x`)},
+		"inc/sys.h": {Data:[]byte(`sys #include "sys/x.h"`)},
+	}
+	c := &Includer{Resolver:&FSResolver{FS:fsys,Dirs:[]string{"inc","src"}}}
+	got := included(c.Splice(ScanWith(strings.NewReader(`#include "local.h" #include <sys.h>`),"src/main.c",nil),"src/main.c"))
+	want := "local@src/local.h:1:1 sys@inc/sys.h:1:1 x@src/sys/x.h:1:1 sys@inc/sys.h:1:1 x@src/sys/x.h:1:1"
+	if got!=want { t.Errorf("got  %s\nwant %s",got,want) }
+	if _,_,err := (&FSResolver{FS:fsys}).Resolve("sys.h","src/main.c"); err==nil { t.Error("no error") }
+}
@@ -0,0 +1,81 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "text/scanner"
+import "fmt"
+
+// The token of an input, a Lexer has reported an error for. The TokenText is the error message, Raw the text of the token.
+const LEX_ERROR = rune(-1001)
+
+// A lexical error, like an unterminated string or an invalid character.
+type LexError struct{
+	Pos scanner.Position
+	Msg string
+}
+func (e LexError) Error() string { return fmt.Sprintf("%v: %s",e.Pos,e.Msg) }
+
+/*
+A lexer, that produces the tokens for FromLexer(). Lex returns the next token
+and the lexical error of it, if any. At the end of the input, the Token is
+scanner.EOF.
+*/
+type Lexer interface{
+	Lex() (Token,error)
+}
+
+type lexerSource struct{
+	l Lexer
+	m ModalLexer
+}
+func (s *lexerSource) Next() *Element {
+	var st LexState
+	if s.m!=nil { st = s.m.State() }
+	t,err := s.l.Lex()
+	if t.Token==scanner.EOF && err==nil { return nil }
+	e := t.element(nil)
+	if err!=nil { e.Token,e.TokenText,e.Raw = LEX_ERROR,err.Error(),t.Text }
+	if s.m!=nil { e.lex = &lexState{s.m,st} }
+	e.bs = s
+	return e
+}
+
+// Returns the (lazy) list of the tokens of l. See also ModalLexer.
+func FromLexer(l Lexer) *Element {
+	m,_ := l.(ModalLexer)
+	return (&lexerSource{l,m}).Next()
+}
+
+/*
+Implements Lexer. Unlike Next(), it ignores Trivia, and it doesn't set
+Element.Dict, if used with FromLexer().
+*/
+func (b *BaseScanner) Lex() (Token,error) {
+	n := b.errs
+	e := b.scan()
+	if e==nil { return Token{Token:scanner.EOF,Pos:b.rebase(b.Pos())},nil }
+	if e.Token==LEX_ERROR { return Token{e.Token,e.Raw,e.Start},b.Errors[n] }
+	return Token{e.Token,e.TokenText,e.Start},nil
+}
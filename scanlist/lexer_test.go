@@ -0,0 +1,97 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "text/scanner"
+import "strings"
+import "errors"
+import "fmt"
+import "testing"
+
+type lexStep struct{
+	t Token
+	err error
+}
+
+// A Lexer, that returns its steps and then EOF.
+type stepLexer struct{
+	steps []lexStep
+	calls int
+}
+func (l *stepLexer) Lex() (Token,error) {
+	l.calls++
+	if len(l.steps)==0 { return Token{Token:scanner.EOF},nil }
+	s := l.steps[0]
+	l.steps = l.steps[1:]
+	return s.t,s.err
+}
+
+func TestFromLexer(t *testing.T) {
+	at := func(c int) scanner.Position { return scanner.Position{Filename:"f",Line:1,Column:c,Offset:c-1} }
+	l := &stepLexer{steps:[]lexStep{
+		{Token{0,"a",at(1)},nil},
+		{Token{'$',"$",at(3)},errors.New("bad $")},
+		{Token{scanner.Int,"12",at(5)},nil},
+		{Token{scanner.EOF,"/*",at(8)},errors.New("comment not terminated")},
+	}}
+	e := FromLexer(l)
+	if l.calls!=1 { t.Errorf("%d calls for the first element",l.calls) }
+	var got []string
+	for x := e; x!=nil; x = x.Next() {
+		got = append(got,fmt.Sprintf("%d %q %q %v-%v",x.Token,x.TokenText,x.Raw,x.Start,x.Pos))
+		if l.calls!=len(got) { t.Errorf("%d calls for %d elements",l.calls,len(got)) }
+	}
+	want := []string{
+		fmt.Sprintf(`%d "a" "" f:1:1-f:1:2`,scanner.Ident),
+		fmt.Sprintf(`%d "bad $" "$" f:1:3-f:1:4`,LEX_ERROR),
+		fmt.Sprintf(`%d "12" "" f:1:5-f:1:7`,scanner.Int),
+		fmt.Sprintf(`%d "comment not terminated" "/*" f:1:8-f:1:10`,LEX_ERROR),
+	}
+	if strings.Join(got,"\n")!=strings.Join(want,"\n") { t.Errorf("got\n%s\nwant\n%s",strings.Join(got,"\n"),strings.Join(want,"\n")) }
+	
+	// Every element pulls its successor only once.
+	n := l.calls
+	for x := e; x!=nil; x = x.Next() {}
+	if l.calls!=n { t.Errorf("%d more calls",l.calls-n) }
+	
+	if FromLexer(&stepLexer{})!=nil { t.Error("empty input") }
+}
+
+// A BaseScanner, used as a Lexer, yields the tokens of Next().
+func TestBaseScannerLex(t *testing.T) {
+	src := "a /* c */ 'x' \"s\n b 1.5 `r"
+	list := func(e *Element) string {
+		var s []string
+		for ; e!=nil; e = e.Next() { s = append(s,fmt.Sprintf("%d %q %q %v",e.Token,e.TokenText,e.Raw,e.Start)) }
+		return strings.Join(s,"\n")
+	}
+	b := new(BaseScanner)
+	b.Init(strings.NewReader(src))
+	want := list(b.Next())
+	b = new(BaseScanner)
+	b.Init(strings.NewReader(src))
+	if got := list(FromLexer(b)); got!=want { t.Errorf("got\n%s\nwant\n%s",got,want) }
+	if !strings.Contains(want,fmt.Sprint(LEX_ERROR)) { t.Errorf("no error in\n%s",want) }
+}
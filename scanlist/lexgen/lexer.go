@@ -0,0 +1,103 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package lexgen
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "unicode/utf8"
+import "fmt"
+
+// A scanlist.ModalLexer, that splits a text using a DFA.
+type Lexer struct{
+	d *DFA
+	src string
+	off int
+	pos scanner.Position // The position of src[off:].
+	modes scanlist.Modes
+}
+
+// Returns a Lexer for src.
+func (d *DFA) Lexer(filename,src string) *Lexer {
+	return &Lexer{d:d,src:src,pos:scanner.Position{Filename:filename,Line:1,Column:1}}
+}
+
+func (l *Lexer) State() scanlist.LexState { return scanlist.LexState{l.pos,l.modes} }
+
+func (l *Lexer) Restart(s scanlist.LexState) scanlist.ModalLexer {
+	return &Lexer{d:l.d,src:l.src,off:s.Pos.Offset,pos:s.Pos,modes:s.Modes}
+}
+
+// Returns the (lazy) token list of src.
+func (d *DFA) Scan(filename,src string) *scanlist.Element {
+	return scanlist.FromLexer(d.Lexer(filename,src))
+}
+
+// Returns the definition of the longest match at l.off (or -1) and its end.
+func (l *Lexer) match() (int,int) {
+	s,acc,end := l.d.start(l.modes.Top()),-1,l.off
+	for i := l.off; i<len(l.src); {
+		r,w := rune(l.src[i]),1
+		if r>=utf8.RuneSelf { r,w = utf8.DecodeRuneInString(l.src[i:]) }
+		n := s.next(r)
+		if n<0 { break }
+		s = l.d.states[n]
+		i += w
+		if s.accept>=0 { acc,end = s.accept,i }
+	}
+	return acc,end
+}
+
+func (l *Lexer) advance(end int) (string,scanner.Position) {
+	text,start := l.src[l.off:end],l.pos
+	for _,r := range text {
+		l.pos.Column++
+		if r=='\n' { l.pos.Line++; l.pos.Column = 1 }
+	}
+	l.pos.Offset += len(text)
+	l.off = end
+	return text,start
+}
+
+/*
+Implements scanlist.Lexer. A character, that doesn't start a match, is
+returned as a single token together with an error.
+*/
+func (l *Lexer) Lex() (scanlist.Token,error) {
+	for l.off<len(l.src) {
+		acc,end := l.match()
+		if acc<0 {
+			r,w := utf8.DecodeRuneInString(l.src[l.off:])
+			text,start := l.advance(l.off+w)
+			return scanlist.Token{r,text,start},scanlist.LexError{start,fmt.Sprintf("invalid character %q",r)}
+		}
+		text,start := l.advance(end)
+		df := &l.d.defs[acc]
+		if df.Pop { l.modes = l.modes.Pop() }
+		for _,m := range df.Push { l.modes = l.modes.Push(m) }
+		if df.Skip { continue }
+		return scanlist.Token{l.d.Dict.Get(text,df.Token),text,start},nil
+	}
+	return scanlist.Token{Token:scanner.EOF,Pos:l.pos},nil
+}
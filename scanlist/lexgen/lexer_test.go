@@ -0,0 +1,113 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package lexgen
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "strings"
+import "fmt"
+import "testing"
+
+const (
+	M_STR = 1
+	T_TEXT = -200-iota
+	T_INTERP
+)
+
+// String interpolation, as in the README.
+var interp = MustCompile(
+	Literal(`"`,0).Enter(M_STR),
+	Regex(`([^"$\\]|\\.)+|\$`,T_TEXT).In(M_STR),
+	Literal("${",T_INTERP).In(M_STR).Enter(0),
+	Literal(`"`,0).In(M_STR).Leave(),
+	Literal("{",0).Enter(0),
+	Literal("}",0).Leave(),
+	Regex(`[a-z]+`,scanner.Ident),
+	Skip(` +`),
+)
+
+// Returns the mode stacks of the elements of e, separated by spaces.
+func modes(e *scanlist.Element) string {
+	var s []string
+	for ; e!=nil; e = e.Next() {
+		st,ok := e.LexState()
+		if !ok { return "no state" }
+		s = append(s,fmt.Sprint(st.Modes))
+	}
+	return strings.Join(s," ")
+}
+
+func TestModes(t *testing.T) {
+	src := `x "a ${ {y} } $" }z`
+	want := `id:x 34:" -201:a  -202:${ 123:{ id:y 125:} 125:} -201:  -201:$ 34:" 125:} id:z`
+	if got := lex(interp,src); got!=want { t.Errorf("got  %q\nwant %q",got,want) }
+	// A '}' at the top leaves nothing.
+	want = `[] [] [1] [1] [1 0] [1 0 0] [1 0 0] [1 0] [1] [1] [1] [] []`
+	if got := modes(interp.Scan("",src)); got!=want { t.Errorf("got  %q\nwant %q",got,want) }
+	
+	// '$' is only a token in M_STR.
+	if got,want := lex(interp,`$"$"`),`!$ 34:" -201:$ 34:"`; got!=want { t.Errorf("got %q, want %q",got,want) }
+}
+
+// Restarting from a saved state lexes the same tokens, and doesn't affect the lexer.
+func TestRestart(t *testing.T) {
+	src := `a "b ${c}" d`
+	var all []scanlist.Token
+	var states []scanlist.LexState
+	l := interp.Lexer("f",src)
+	for {
+		states = append(states,l.State())
+		tk,err := l.Lex()
+		if err!=nil { t.Fatal(err) }
+		if tk.Token==scanner.EOF { break }
+		all = append(all,tk)
+	}
+	for i,st := range states {
+		r := l.Restart(st)
+		for j := i; ; j++ {
+			tk,_ := r.Lex()
+			if j==len(all) {
+				if tk.Token!=scanner.EOF { t.Errorf("%d: got %q after the end",i,tk.Text) }
+				break
+			}
+			if tk!=all[j] { t.Errorf("%d: token %d is %v, want %v",i,j,tk,all[j]); break }
+		}
+	}
+	if tk,_ := l.Lex(); tk.Token!=scanner.EOF { t.Errorf("the lexer moved to %q",tk.Text) }
+}
+
+// Relexing an element with other modes gives a new list and keeps the old one.
+func TestRelex(t *testing.T) {
+	e := interp.Scan("","a b")
+	old := list(e)
+	s := e.PushMode(M_STR)
+	if got,want := list(s),"-201:a b"; got!=want { t.Errorf("pushed: got %q, want %q",got,want) }
+	if st,_ := s.LexState(); fmt.Sprint(st.Modes)!="[1]" { t.Errorf("pushed: modes %v",st.Modes) }
+	if got := list(s.PopMode()); got!=old { t.Errorf("popped: got %q, want %q",got,old) }
+	// Relexing starts before the skipped input.
+	if got := list(e.Next().Relex(scanlist.Modes{M_STR})); got!="-201: b" { t.Errorf("relexed b: got %q",got) }
+	if got := list(e); got!=old { t.Errorf("the list changed to %q",got) }
+	if old!="id:a id:b" { t.Errorf("got %q",old) }
+}
@@ -0,0 +1,266 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+A lexer generator. An ordered list of token definitions is compiled into a
+single DFA, which splits the input into longest matches. If several
+definitions match the same (longest) text, the first one wins.
+*/
+package lexgen
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "regexp/syntax"
+import "unicode"
+import "sort"
+import "strings"
+import "fmt"
+
+/*
+A token definition. Pattern is a regular expression (regexp syntax) or, if
+Literal is set, a literal text. Text matched by a Skip definition (like
+whitespace or comments) is dropped.
+
+A definition is only active in its Mode. After a match, the current mode is
+popped (if Pop is set) and the modes of Push are pushed (see scanlist.Modes).
+*/
+type Def struct{
+	Pattern string
+	Literal bool
+	Token rune
+	Skip bool
+	Mode int
+	Push []int
+	Pop bool
+}
+
+func Regex(pattern string,token rune) Def { return Def{Pattern:pattern,Token:token} }
+
+// A literal definition. A token of 0 means the character itself, if text is a single character.
+func Literal(text string,token rune) Def { return Def{Pattern:text,Literal:true,Token:token} }
+
+func Skip(pattern string) Def { return Def{Pattern:pattern,Skip:true} }
+
+// Returns d, active in mode.
+func (d Def) In(mode int) Def { d.Mode = mode; return d }
+
+// Returns d, that enters mode after a match.
+func (d Def) Enter(mode int) Def { d.Push = append(d.Push[:len(d.Push):len(d.Push)],mode); return d }
+
+// Returns d, that leaves the current mode after a match.
+func (d Def) Leave() Def { d.Pop = true; return d }
+
+type span struct{
+	lo,hi rune
+	next int32
+}
+
+type state struct{
+	accept int // The index of the matched definition, or -1.
+	ascii [128]int32 // The transitions for ASCII characters, -1 for none.
+	spans []span // The other transitions, sorted.
+}
+
+func (s *state) next(r rune) int32 {
+	if r>=0 && r<128 { return s.ascii[r] }
+	i := sort.Search(len(s.spans),func(i int) bool { return s.spans[i].hi>=r })
+	if i<len(s.spans) && s.spans[i].lo<=r { return s.spans[i].next }
+	return -1
+}
+
+// A compiled lexer.
+type DFA struct{
+	Dict scanlist.TokenDict // The keywords. Overrides the Token of the matched text.
+	defs []Def
+	states []*state
+	starts map[int]int32 // The start state of each mode.
+}
+
+// Returns the start state of mode. A mode without definitions matches nothing.
+func (d *DFA) start(mode int) *state {
+	if i,ok := d.starts[mode]; ok { return d.states[i] }
+	return d.states[0]
+}
+
+// The combined NFA of all definitions.
+type nfa struct{
+	inst []syntax.Inst
+	def []int // The definition of each instruction.
+}
+
+func (n *nfa) add(p *syntax.Prog,d int) (uint32,error) {
+	off := uint32(len(n.inst))
+	for _,in := range p.Inst {
+		switch in.Op {
+		case syntax.InstEmptyWidth: return 0,fmt.Errorf("empty-width assertions are not supported")
+		case syntax.InstAlt,syntax.InstAltMatch: in.Arg += off
+		}
+		in.Out += off
+		n.inst = append(n.inst,in)
+		n.def = append(n.def,d)
+	}
+	return off+uint32(p.Start),nil
+}
+
+// Returns the sorted rune-consuming and matching instructions, reachable from pcs.
+func (n *nfa) closure(pcs []uint32) (out []uint32) {
+	seen := make(map[uint32]bool)
+	var walk func(pc uint32)
+	walk = func(pc uint32) {
+		if seen[pc] { return }
+		seen[pc] = true
+		in := &n.inst[pc]
+		switch in.Op {
+		case syntax.InstAlt,syntax.InstAltMatch: walk(in.Out); walk(in.Arg)
+		case syntax.InstCapture,syntax.InstNop: walk(in.Out)
+		case syntax.InstFail:
+		default: out = append(out,pc)
+		}
+	}
+	for _,pc := range pcs { walk(pc) }
+	sort.Slice(out,func(i,j int) bool { return out[i]<out[j] })
+	return
+}
+
+// Returns the ranges of runes, the instruction in consumes.
+func ranges(in *syntax.Inst) []rune {
+	switch in.Op {
+	case syntax.InstRune1: return []rune{in.Rune[0],in.Rune[0]}
+	case syntax.InstRuneAny: return []rune{0,unicode.MaxRune}
+	case syntax.InstRuneAnyNotNL: return []rune{0,'\n'-1,'\n'+1,unicode.MaxRune}
+	case syntax.InstRune:
+		if len(in.Rune)==1 { // FoldCase
+			var rs []rune
+			r := in.Rune[0]
+			for f := unicode.SimpleFold(r); ; f = unicode.SimpleFold(f) {
+				rs = append(rs,f,f)
+				if f==r { break }
+			}
+			return rs
+		}
+		return in.Rune
+	}
+	return nil
+}
+
+func matches(in *syntax.Inst,r rune) bool {
+	switch in.Op {
+	case syntax.InstRuneAny: return true
+	case syntax.InstRuneAnyNotNL: return r!='\n'
+	}
+	return in.MatchRune(r)
+}
+
+func key(set []uint32) string {
+	var b strings.Builder
+	for _,pc := range set { fmt.Fprint(&b,pc,",") }
+	return b.String()
+}
+
+// Builds the DFA by subset construction.
+func (d *DFA) build(n *nfa,starts map[int][]uint32) {
+	index := make(map[string]int32)
+	var sets [][]uint32
+	intern := func(set []uint32) int32 {
+		k := key(set)
+		if i,ok := index[k]; ok { return i }
+		i := int32(len(sets))
+		index[k] = i
+		sets = append(sets,set)
+		return i
+	}
+	intern(nil) // Matches nothing.
+	modes := make([]int,0,len(starts))
+	for m := range starts { modes = append(modes,m) }
+	sort.Ints(modes)
+	d.starts = make(map[int]int32)
+	for _,m := range modes { d.starts[m] = intern(n.closure(starts[m])) }
+	for i := 0; i<len(sets); i++ {
+		s := &state{accept:-1}
+		var bounds []rune
+		for _,pc := range sets[i] {
+			in := &n.inst[pc]
+			if in.Op==syntax.InstMatch {
+				if s.accept<0 || n.def[pc]<s.accept { s.accept = n.def[pc] }
+				continue
+			}
+			rs := ranges(in)
+			for j := 0; j+1<len(rs); j += 2 { bounds = append(bounds,rs[j],rs[j+1]+1) }
+		}
+		bounds = append(bounds,0,unicode.MaxRune+1)
+		sort.Slice(bounds,func(i,j int) bool { return bounds[i]<bounds[j] })
+		for j := range s.ascii { s.ascii[j] = -1 }
+		for j := 0; j+1<len(bounds); j++ {
+			lo,hi := bounds[j],bounds[j+1]-1
+			if lo>hi { continue }
+			var to []uint32
+			for _,pc := range sets[i] {
+				in := &n.inst[pc]
+				if in.Op!=syntax.InstMatch && matches(in,lo) { to = append(to,in.Out) }
+			}
+			if len(to)==0 { continue }
+			t := intern(n.closure(to))
+			for ; lo<=hi && lo<128; lo++ { s.ascii[lo] = t }
+			if lo>hi { continue }
+			if l := len(s.spans); l>0 && s.spans[l-1].next==t && s.spans[l-1].hi+1==lo {
+				s.spans[l-1].hi = hi
+			} else {
+				s.spans = append(s.spans,span{lo,hi,t})
+			}
+		}
+		d.states = append(d.states,s)
+	}
+}
+
+// Compiles the definitions into a DFA.
+func Compile(defs ...Def) (*DFA,error) {
+	d := &DFA{defs:make([]Def,len(defs))}
+	n := new(nfa)
+	starts := make(map[int][]uint32)
+	for i,df := range defs {
+		flags := syntax.Perl
+		if df.Literal { flags = syntax.Literal }
+		if df.Token==0 && !df.Skip {
+			if r := []rune(df.Pattern); df.Literal && len(r)==1 { df.Token = r[0] } else {
+				return nil,fmt.Errorf("lexgen: definition %d (%q) has no token",i,df.Pattern)
+			}
+		}
+		d.defs[i] = df
+		re,err := syntax.Parse(df.Pattern,flags)
+		if err!=nil { return nil,fmt.Errorf("lexgen: definition %d: %v",i,err) }
+		p,err := syntax.Compile(re.Simplify())
+		if err!=nil { return nil,fmt.Errorf("lexgen: definition %d: %v",i,err) }
+		pc,err := n.add(p,i)
+		if err!=nil { return nil,fmt.Errorf("lexgen: definition %d (%q): %v",i,df.Pattern,err) }
+		starts[df.Mode] = append(starts[df.Mode],pc)
+	}
+	d.build(n,starts)
+	return d,nil
+}
+
+// Like Compile, but panics on errors.
+func MustCompile(defs ...Def) *DFA {
+	d,err := Compile(defs...)
+	if err!=nil { panic(err) }
+	return d
+}
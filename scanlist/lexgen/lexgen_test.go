@@ -0,0 +1,125 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package lexgen
+
+import "github.com/byte-mug/semiparse/scanlist"
+import "text/scanner"
+import "strings"
+import "fmt"
+import "testing"
+
+const (
+	T_EQ = -100-iota
+	T_IF
+	T_NUM
+)
+
+// Returns the tokens of src as "token:text" (LEX_ERROR: "!raw"), separated by spaces.
+func lex(d *DFA,src string) string { return list(d.Scan("",src)) }
+
+func list(e *scanlist.Element) string {
+	var s []string
+	for ; e!=nil; e = e.Next() {
+		switch e.Token {
+		case scanlist.LEX_ERROR: s = append(s,"!"+e.Raw)
+		case scanner.Ident: s = append(s,"id:"+e.TokenText)
+		default: s = append(s,fmt.Sprint(e.Token,":",e.TokenText))
+		}
+	}
+	return strings.Join(s," ")
+}
+
+func TestLongestMatch(t *testing.T) {
+	d := MustCompile(
+		Literal("=",0),
+		Literal("==",T_EQ),
+		Regex(`[0-9]+(\.[0-9]+)?`,T_NUM),
+		Regex(`[a-z]+`,scanner.Ident),
+		Skip(`\s+`),
+	)
+	for _,c := range []struct{ src, want string }{
+		{"a==b",     "id:a -100:== id:b"},
+		{"a = b",    "id:a 61:= id:b"},
+		{"===",      "-100:== 61:="},
+		{"ab12",     "id:ab -102:12"},
+		{"1.5",      "-102:1.5"},
+		{"1.",       "-102:1 !."}, // The DFA doesn't backtrack into a longer prefix.
+		{"",         ""},
+	} {
+		if got := lex(d,c.src); got!=c.want { t.Errorf("%q: got %q, want %q",c.src,got,c.want) }
+	}
+}
+
+// Equal-length matches go to the first definition.
+func TestPriority(t *testing.T) {
+	kw := MustCompile(Literal("if",T_IF),Regex(`[a-z]+`,scanner.Ident),Skip(` +`))
+	if got,want := lex(kw,"if iff i"),"-101:if id:iff id:i"; got!=want { t.Errorf("got %q, want %q",got,want) }
+	id := MustCompile(Regex(`[a-z]+`,scanner.Ident),Literal("if",T_IF),Skip(` +`))
+	if got,want := lex(id,"if iff"),"id:if id:iff"; got!=want { t.Errorf("got %q, want %q",got,want) }
+	
+	// The Dict overrides the token of the matched text.
+	id.Dict = scanlist.TokenDict{"iff":T_IF}
+	if got,want := lex(id,"if iff"),"id:if -101:iff"; got!=want { t.Errorf("got %q, want %q",got,want) }
+}
+
+func TestSkip(t *testing.T) {
+	d := MustCompile(
+		Regex(`[a-z]+`,scanner.Ident),
+		Skip(`[ \t\n]+`),
+		Skip(`//[^\n]*`),
+		Skip(`/\*(?s:.)*?\*/`),
+	)
+	src := "a // x\n  b/* y\n*/c\t"
+	if got,want := lex(d,src),"id:a id:b id:c"; got!=want { t.Errorf("got %q, want %q",got,want) }
+	var pos []string
+	for e := d.Scan("f",src); e!=nil; e = e.Next() { pos = append(pos,e.Start.String()) }
+	if got,want := strings.Join(pos," "),"f:1:1 f:2:3 f:3:3"; got!=want { t.Errorf("positions %q, want %q",got,want) }
+	if e := d.Scan("","  // only skipped\n"); e!=nil { t.Errorf("got %v",e.TokenText) }
+}
+
+func TestUnmatched(t *testing.T) {
+	d := MustCompile(Regex(`[a-z]+`,scanner.Ident),Skip(` +`))
+	if got,want := lex(d,"a $ b€c"),"id:a !$ id:b !€ id:c"; got!=want { t.Errorf("got %q, want %q",got,want) }
+	e := d.Scan("f","ab  $").Next()
+	if e.Token!=scanlist.LEX_ERROR || e.TokenText!=`f:1:5: invalid character '$'` || e.Start.String()!="f:1:5" {
+		t.Errorf("got %d %q at %v",e.Token,e.TokenText,e.Start)
+	}
+	
+	// A mode without definitions matches nothing.
+	if got,want := lex(MustCompile(Regex(`a`,scanner.Ident).In(1)),"a"),"!a"; got!=want { t.Errorf("got %q, want %q",got,want) }
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _,defs := range [][]Def{
+		{Regex(`a`,0)},
+		{Literal("ab",0)},
+		{Regex(`(a`,scanner.Ident)},
+		{Regex(`^a`,scanner.Ident)},
+		{Regex(`a\b`,scanner.Ident)},
+	} {
+		if _,err := Compile(defs...); err==nil { t.Errorf("%v: no error",defs) }
+	}
+	if _,err := Compile(Literal("(",0),Literal("a+",scanner.Ident)); err!=nil { t.Error(err) }
+}
@@ -0,0 +1,96 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "text/scanner"
+
+// A stack of lexer modes. The current mode is the last one; the empty stack is mode 0.
+type Modes []int
+
+func (m Modes) Top() int {
+	if len(m)==0 { return 0 }
+	return m[len(m)-1]
+}
+
+// Returns m with mode pushed. m is not modified.
+func (m Modes) Push(mode int) Modes {
+	return append(m[:len(m):len(m)],mode)
+}
+
+// Returns m without its top. Popping the empty stack has no effect.
+func (m Modes) Pop() Modes {
+	if len(m)==0 { return m }
+	return m[:len(m)-1:len(m)-1]
+}
+
+// The state of a ModalLexer before a token: the position and the mode stack, it is lexed in.
+type LexState struct{
+	Pos scanner.Position
+	Modes Modes
+}
+
+/*
+A Lexer with modes. Restart returns a new lexer for the same input, starting
+at the state s; the receiver is not affected.
+*/
+type ModalLexer interface{
+	Lexer
+	State() LexState
+	Restart(s LexState) ModalLexer
+}
+
+type lexState struct{
+	l ModalLexer
+	s LexState
+}
+
+// Returns the state, e has been lexed in, if e comes from a ModalLexer (see FromLexer).
+func (e *Element) LexState() (LexState,bool) {
+	if e==nil || e.lex==nil { return LexState{},false }
+	return e.lex.s,true
+}
+
+/*
+Returns a new list, that is lexed from the start of e (including any skipped
+input before it) with the mode stack m. The list of e is not modified, so
+it stays valid for other parses (like backtracking alternatives). If e doesn't
+come from a ModalLexer, e is returned.
+*/
+func (e *Element) Relex(m Modes) *Element {
+	if e==nil || e.lex==nil { return e }
+	return FromLexer(e.lex.l.Restart(LexState{e.lex.s.Pos,m}))
+}
+
+// Relexes e with mode pushed. See Relex.
+func (e *Element) PushMode(mode int) *Element {
+	s,_ := e.LexState()
+	return e.Relex(s.Modes.Push(mode))
+}
+
+// Relexes e with the current mode popped. See Relex.
+func (e *Element) PopMode() *Element {
+	s,_ := e.LexState()
+	return e.Relex(s.Modes.Pop())
+}
@@ -0,0 +1,52 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "fmt"
+import "strings"
+import "testing"
+
+// Push and Pop don't modify the stack, they are called on.
+func TestModes(t *testing.T) {
+	var m Modes
+	if m.Top()!=0 || len(m.Pop())!=0 { t.Error("empty stack") }
+	a := m.Push(1)
+	b := a.Push(2)
+	c := a.Push(3)
+	d := b.Pop().Push(4)
+	if got := fmt.Sprint(a,b,c,d); got!="[1] [1 2] [1 3] [1 4]" { t.Errorf("got %s",got) }
+	if b.Top()!=2 || d.Top()!=4 || a.Pop().Top()!=0 { t.Error("Top") }
+}
+
+// Elements without a ModalLexer have no state and aren't relexed.
+func TestRelexPlain(t *testing.T) {
+	b := new(BaseScanner)
+	b.Init(strings.NewReader("a b"))
+	e := b.Next()
+	if _,ok := e.LexState(); ok { t.Error("BaseScanner: has a state") }
+	if e.PushMode(1)!=e || e.PopMode()!=e { t.Error("BaseScanner: relexed") }
+	var n *Element
+	if n.Relex(Modes{1})!=nil { t.Error("nil: relexed") }
+}
@@ -0,0 +1,60 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "strings"
+import "io"
+import "fmt"
+import "testing"
+
+func TestRuneScanner(t *testing.T) {
+	src := "aé€😀\n\nb\xff."
+	want := []string{
+		"a f:1:1 0", "é f:1:2 1", "€ f:1:3 3", "😀 f:1:4 6", "\n f:1:5 10",
+		"\n f:2:1 11", "b f:3:1 12", "� f:3:2 13", ". f:3:3 14",
+	}
+	// A reader without ReadRune gets buffered.
+	for _,r := range []io.Reader{strings.NewReader(src),io.MultiReader(strings.NewReader(src))} {
+		s := new(RuneScanner).Init(r)
+		s.SetFilename("f")
+		var got []string
+		for e := s.Next(); e!=nil; e = e.Next() {
+			if e.Pos!=e.Start || e.Token!=[]rune(e.TokenText)[0] { t.Errorf("%q: Pos %v, Start %v, Token %q",e.TokenText,e.Pos,e.Start,e.Token) }
+			got = append(got,fmt.Sprint(e.TokenText," ",e.Start," ",e.Start.Offset))
+		}
+		if strings.Join(got,"|")!=strings.Join(want,"|") { t.Errorf("%T: got\n%q\nwant\n%q",r,got,want) }
+	}
+}
+
+// At the end of the input, the list continues with Concat.
+func TestRuneScannerEOF(t *testing.T) {
+	if e := Runes(strings.NewReader("")); e!=nil { t.Errorf("empty input: %q",e.TokenText) }
+	tail := &Element{Token:-1,TokenText:"tail"}
+	s := new(RuneScanner).Init(strings.NewReader("x"))
+	s.Concat = tail
+	e := s.Next()
+	if e==nil || e.TokenText!="x" || e.Next()!=tail { t.Error("Concat isn't appended") }
+	if e.Next()!=tail { t.Error("Next isn't stable") }
+}
@@ -28,6 +28,9 @@ A Lazy-Evaluating Linked list around the "text/scanner" package.
 package scanlist
 
 import "text/scanner"
+import "bufio"
+import "io"
+import "strings"
 
 type TokenDict map[string]rune
 func (t TokenDict) Get(s string, r rune) rune {
@@ -45,38 +48,427 @@ func (t TokenDict) Join(o TokenDict) TokenDict {
 	return n
 }
 
+// Returns, whether s is a prefix of a key of t.
+func (t TokenDict) extends(s string) bool {
+	for k := range t {
+		if strings.HasPrefix(k,s) { return true }
+	}
+	return false
+}
+
 type BaseScanner struct{
 	scanner.Scanner
 	Dict TokenDict
 	Concat *Element
+	
+	// If Base.Line>0, the input starts at Base (for rescanning the rest of a file).
+	Base scanner.Position
+	
+	/*
+	Multi-character operators, like "==" or "->". Punctuation is combined into
+	the longest operator (maximal munch), that doesn't contain whitespace.
+	Other keys (like keywords) are ignored, so Ops may be the same as Dict.
+	*/
+	Ops TokenDict
+	pend []opChar
+	dict TokenDict // Dict joined with Ops
+	
+	// If set, whitespace and comments are attached to the elements. See Trivia.
+	Trivia bool
+	triv *triviaState
+	
+	// With Trivia, the trivia of an input, that contains no token at all (so
+	// there is no element to attach it to).
+	EOFTrivia []Trivia
+	
+	/*
+	The lexical errors, reported by the scanner so far. A token with an error
+	is replaced by a LEX_ERROR element. A previously set Error handler is still
+	called.
+	*/
+	Errors []LexError
+	hooked bool
+	errs int // The first error, that hasn't been attached to a token yet.
+}
+type opChar struct{
+	r rune
+	start, end scanner.Position
 }
+
+// Translates a position of the scanner into one relative to b.Base.
+func (b *BaseScanner) rebase(p scanner.Position) scanner.Position {
+	if b.Base.Line<=0 { return p }
+	if p.Line==1 { p.Column += b.Base.Column-1 }
+	p.Line += b.Base.Line-1
+	p.Offset += b.Base.Offset
+	if p.Filename=="" { p.Filename = b.Base.Filename }
+	return p
+}
+
 func (b *BaseScanner) Next() *Element {
+	var e *Element
+	if b.Trivia { e = b.trivia() } else { e = b.scan() }
+	if e==nil { return b.Concat }
+	return e
+}
+
+// Collects the errors of the scanner in b.Errors.
+func (b *BaseScanner) hook() {
+	b.hooked = true
+	h := b.Error
+	b.Error = func(s *scanner.Scanner,msg string) {
+		pos := s.Position
+		// Invalid UTF-8 is reported, when the character is read ahead; Pos() is at the character.
+		if !pos.IsValid() || msg=="invalid UTF-8 encoding" { pos = s.Pos() }
+		b.Errors = append(b.Errors,LexError{b.rebase(pos),msg})
+		if h!=nil { h(s,msg) }
+	}
+}
+
+/*
+Returns a LEX_ERROR element in place of the current token t, if there are
+errors before its end. At the end of the input, all remaining errors are
+reported.
+*/
+func (b *BaseScanner) lexError(t rune) *Element {
+	end := b.rebase(b.Pos()).Offset
+	if b.errs==len(b.Errors) || (t!=scanner.EOF && b.Errors[b.errs].Pos.Offset>=end) { return nil }
+	d := b.Errors[b.errs]
+	for b.errs<len(b.Errors) && (t==scanner.EOF || b.Errors[b.errs].Pos.Offset<end) { b.errs++ }
+	e := b.element(LEX_ERROR,d.Error(),b.Position,b.Pos())
+	e.Raw = b.TokenText()
+	if t==scanner.EOF { e.Start = d.Pos }
+	return e
+}
+
+// Returns the next token, or nil at the end of the input.
+func (b *BaseScanner) scan() *Element {
+	if len(b.pend)>0 { return b.munch() }
+	if !b.hooked { b.hook() }
 	t := b.Scan()
-	if t==scanner.EOF { return b.Concat }
+	if e := b.lexError(t); e!=nil { return e }
+	if t==scanner.EOF { return nil }
+	if t>=0 && b.Ops!=nil {
+		b.pend = append(b.pend[:0],opChar{t,b.Position,b.Pos()})
+		return b.munch()
+	}
 	s := b.TokenText()
+	return b.element(b.Dict.Get(s,t),s,b.Position,b.Pos())
+}
+
+// Reads the longest operator of b.Ops, that starts with the pending characters.
+func (b *BaseScanner) munch() *Element {
+	s := ""
+	for _,c := range b.pend { s += string(c.r) }
+	for b.Ops.extends(s+string(b.Peek())) {
+		st := b.Pos()
+		c := b.Scanner.Next()
+		b.pend = append(b.pend,opChar{c,st,b.Pos()})
+		s += string(c)
+	}
+	k := len(b.pend)
+	for ; k>1; k-- {
+		if _,ok := b.Ops[s]; ok { break }
+		s = s[:len(s)-len(string(b.pend[k-1].r))]
+	}
+	t := b.Ops.Get(s,b.pend[0].r)
+	if k==1 { t = b.Dict.Get(s,t) }
+	e := b.element(t,s,b.pend[0].start,b.pend[k-1].end)
+	b.pend = b.pend[k:]
+	return e
+}
+
+func (b *BaseScanner) element(t rune,s string,start, end scanner.Position) *Element {
 	e := new(Element)
-	e.Token = b.Dict.Get(s,t)
+	e.Token = t
 	e.TokenText = s
-	e.Pos = b.Pos()
+	e.Pos = b.rebase(end)
+	e.Start = b.rebase(start)
 	e.Dict = b.Dict
+	if b.Ops!=nil {
+		if b.dict==nil { b.dict = b.Dict.Join(b.Ops) }
+		e.Dict = b.dict
+	}
 	e.bs = b
 	return e
 }
 
+/*
+A scanner, that produces one Element per rune, for scannerless parsing. The
+Token of each element is the rune itself and Pos is its start position.
+*/
+type RuneScanner struct{
+	r io.RuneReader
+	pos scanner.Position
+	Concat *Element
+}
+func (b *RuneScanner) Init(src io.Reader) *RuneScanner {
+	if rr,ok := src.(io.RuneReader); ok {
+		b.r = rr
+	} else {
+		b.r = bufio.NewReader(src)
+	}
+	b.pos = scanner.Position{Line:1,Column:1}
+	return b
+}
+
+// Sets the file name of the positions.
+func (b *RuneScanner) SetFilename(fn string) { b.pos.Filename = fn }
+
+func (b *RuneScanner) Next() *Element {
+	c,n,err := b.r.ReadRune()
+	if err!=nil { return b.Concat }
+	e := new(Element)
+	e.Token = c
+	e.TokenText = string(c)
+	e.Pos = b.pos
+	e.Start = b.pos
+	e.bs = b
+	b.pos.Offset += n
+	if c=='\n' {
+		b.pos.Line++
+		b.pos.Column = 1
+	} else {
+		b.pos.Column++
+	}
+	return e
+}
+
+// Shorthand for new(RuneScanner).Init(src).Next().
+func Runes(src io.Reader) *Element {
+	return new(RuneScanner).Init(src).Next()
+}
+
+// The lazy source of the elements, following an Element.
+type Source interface{
+	Next() *Element
+}
+
 type Element struct {
 	Token rune
 	TokenText string
+	Raw string // The source text of a LEX_ERROR element, whose TokenText is the error message.
 	Pos scanner.Position
+	Start scanner.Position // The position of the first character (Pos may be past the token).
 	Dict TokenDict // for Include-Functions.
-	bs *BaseScanner
+	Leading, Trailing []Trivia // see BaseScanner.Trivia
+	Include *Include // see Includer
+	Expansion *Expansion // the macro expansion, the element results from
+	lex *lexState // see Relex
+	bs Source
 	e  *Element
 }
 func (e *Element) Next() *Element {
 	if e.bs==nil { return e.e }
+	if t,ok := e.bs.(*tracked); ok { return t.Next() }
+	if s,ok := e.bs.(*synced); ok { return s.Next() }
 	e.e = e.bs.Next()
 	e.bs = nil
 	return e.e
 }
+/*
+Returns a copy of e, that is followed by next rather than by e's successors.
+This allows to build modified token lists, that share their tail with the
+original one.
+*/
+func (e *Element) Relink(next *Element) *Element {
+	c := &Element{Token:e.Token,TokenText:e.TokenText,Raw:e.Raw,Pos:e.Pos,Start:e.Start,Dict:e.Dict,Leading:e.Leading,Trailing:e.Trailing,Include:e.Include,Expansion:e.Expansion,lex:e.lex}
+	c.e = next
+	return c
+}
+
+// Returns a copy of e, that is followed by the elements of src (src.Next() is called, when needed).
+func (e *Element) RelinkLazy(src Source) *Element {
+	c := e.Relink(nil)
+	c.bs = src
+	return c
+}
+
+/*
+A macro expansion. Macro has been invoked at the position of the element, the
+element has been spelled at Spelling (within the definition of Macro). Parent
+is the expansion, the invocation results from, if any.
+*/
+type Expansion struct{
+	Macro string
+	Spelling scanner.Position
+	Parent *Expansion
+}
+
+/*
+Returns the tokens of src, scanned by a BaseScanner with the TokenDict of
+another list (Element.Dict). The operators of dict are recognized as well.
+*/
+func ScanWith(src io.Reader,filename string,dict TokenDict) *Element {
+	s := new(BaseScanner)
+	s.Init(src)
+	s.Filename = filename
+	s.Dict = dict
+	s.Ops = dict
+	return s.Next()
+}
+type watcher struct{
+	orig *Element
+	i int
+	f func(i int)
+}
+func (w *watcher) Next() *Element {
+	o := w.orig.Next()
+	if o==nil { return nil }
+	c := o.Relink(nil)
+	c.bs = &watcher{o,w.i+1,w.f}
+	w.f(w.i+1)
+	return c
+}
+
+/*
+Records, how far a parser has looked into the lists, created by Track(): Max
+is the furthest end offset (Start.Offset+len(TokenText)) of all elements,
+that have been returned by Next(), or EOF (the maximum int), if Next() has
+returned nil.
+*/
+type Tracker struct{
+	Max int
+}
+const EOF = int(^uint(0)>>1)
+
+// Returns the end offset of e (see Tracker).
+func EndOffset(e *Element) int {
+	if e==nil { return EOF }
+	if e.Token==LEX_ERROR { return e.Pos.Offset } // TokenText is the error message.
+	return e.Start.Offset+len(e.TokenText)
+}
+
+// Records, that e has been looked at.
+func (t *Tracker) See(e *Element) { t.Saw(EndOffset(e)) }
+
+// Records, that everything up to the end offset o has been looked at.
+func (t *Tracker) Saw(o int) { if o>t.Max { t.Max = o } }
+
+type tracked struct{
+	orig *Element
+	t *Tracker
+	done bool
+	n *Element
+}
+func (s *tracked) Next() *Element {
+	if !s.done {
+		s.done = true
+		if o := s.orig.Next(); o!=nil {
+			s.n = o.Relink(nil)
+			s.n.bs = &tracked{orig:o,t:s.t}
+		}
+	}
+	s.t.See(s.n)
+	return s.n
+}
+
+/*
+Returns a lazy copy of the list e, that reports every call of Next() to t.
+*/
+func (t *Tracker) Track(e *Element) *Element {
+	if e==nil { return nil }
+	c := e.Relink(nil)
+	c.bs = &tracked{orig:e,t:t}
+	return c
+}
+
+/*
+Replaces the elements after e, which must be an element of a list, created by
+t.Track(), with a tracked copy of rest.
+*/
+func (t *Tracker) Cut(e *Element,rest *Element) {
+	s := e.bs.(*tracked)
+	s.done = true
+	s.n = t.Track(rest)
+}
+
+/*
+Like Cut(e,rest), but reuses the old elements after e (old is the first one),
+once rest re-synchronizes with them: from the first element of rest on, that
+starts at or after the offset from and equals an old element, that starts
+delta bytes before, the old elements take the place of the matching ones (and
+get their positions). Only old elements, that have been materialized, are
+reused. If e is nil, old is the head of a list, created by t.Track(), and
+the new list is returned as head.
+
+Returns the reused elements and the end offset in the old list, up to which
+they reach (EOF, if they reach its end).
+*/
+func (t *Tracker) Resync(e, old, rest *Element, from, delta int) (head *Element, reused []*Element, limit int) {
+	byOff := make(map[int]*Element)
+	maxOff := -1
+	for o := old; o!=nil; {
+		if _,ok := byOff[o.Start.Offset]; !ok { byOff[o.Start.Offset] = o }
+		if o.Start.Offset>maxOff { maxOff = o.Start.Offset }
+		s,ok := o.bs.(*tracked)
+		if !ok || !s.done { break }
+		o = s.n
+	}
+	same := func(o,r *Element) bool {
+		return o.Token==r.Token && o.TokenText==r.TokenText && o.Raw==r.Raw && r.Start.Offset-o.Start.Offset==delta &&
+			r.Pos.Offset-o.Pos.Offset==delta && sameModes(o.lex,r.lex)
+	}
+	var prev *Element
+	link := func(n *Element) {
+		switch {
+		case prev!=nil: prev.bs.(*tracked).link(n)
+		case e!=nil: e.bs.(*tracked).link(n)
+		default: head = n
+		}
+	}
+	r := rest
+	for ; r!=nil && r.Start.Offset-delta<=maxOff; r = r.Next() {
+		if o := byOff[r.Start.Offset-delta]; o!=nil && r.Start.Offset>=from && same(o,r) { break }
+		c := r.Relink(nil)
+		c.bs = &tracked{orig:r,t:t}
+		link(c)
+		prev = c
+	}
+	if r==nil || r.Start.Offset-delta>maxOff {
+		link(t.Track(r))
+		return
+	}
+	o := byOff[r.Start.Offset-delta]
+	link(o)
+	for {
+		limit = EndOffset(o)
+		o.Pos,o.Start,o.Dict,o.Leading,o.Trailing,o.Include,o.Expansion,o.lex = r.Pos,r.Start,r.Dict,r.Leading,r.Trailing,r.Include,r.Expansion,r.lex
+		reused = append(reused,o)
+		s := o.bs.(*tracked)
+		r = r.Next()
+		switch {
+		case s.done && s.n!=nil && r!=nil && same(s.n,r): o = s.n; continue
+		case s.done && s.n==nil && r==nil: limit = EOF
+		default: s.link(t.Track(r))
+		}
+		return
+	}
+}
+
+func (s *tracked) link(n *Element) { s.done,s.n = true,n }
+
+func sameModes(a,b *lexState) bool {
+	if a==nil || b==nil { return a==b }
+	if len(a.s.Modes)!=len(b.s.Modes) { return false }
+	for i,m := range a.s.Modes {
+		if b.s.Modes[i]!=m { return false }
+	}
+	return true
+}
+
+/*
+Returns a lazy copy of the list e, that calls f with the index of every
+element, that gets materialized (the index of e is 0). This tells, how far
+a parser has looked into the list.
+*/
+func Watch(e *Element,f func(i int)) *Element {
+	if e==nil { return nil }
+	c := e.Relink(nil)
+	c.bs = &watcher{e,0,f}
+	f(0)
+	return c
+}
 func (e *Element) SafePos() (p scanner.Position) {
 	if e!=nil { p = e.Pos }
 	return
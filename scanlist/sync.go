@@ -0,0 +1,61 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "sync"
+
+type synced struct{
+	orig *Element
+	mu *sync.Mutex // Shared by the list, as the Sources of orig aren't goroutine-safe.
+	once sync.Once
+	n *Element
+}
+func (s *synced) Next() *Element {
+	s.once.Do(func() {
+		s.mu.Lock()
+		o := s.orig.Next()
+		s.mu.Unlock()
+		if o!=nil {
+			s.n = o.Relink(nil)
+			s.n.bs = &synced{orig:o,mu:s.mu}
+		}
+		s.orig = nil
+	})
+	return s.n
+}
+
+/*
+Returns a lazy copy of the list e, that can be walked by several goroutines at
+once. Every element is materialized exactly once; the elements of e are only
+advanced under a lock. e itself must not be used anymore, while the copy is in
+use. Lists derived from the copy (by Relink, Append, Relex and the like) are
+not synchronized.
+*/
+func Synchronized(e *Element) *Element {
+	if e==nil { return nil }
+	c := e.Relink(nil)
+	c.bs = &synced{orig:e,mu:new(sync.Mutex)}
+	return c
+}
@@ -0,0 +1,77 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "strings"
+import "sync"
+import "testing"
+
+func syncSource(n int) string {
+	return strings.Repeat("int a = b + 1; /* x */ f(\"s\", 'c');\n",n)
+}
+
+func TestSynchronized(t *testing.T) {
+	var want []string
+	for e := ScanWith(strings.NewReader(syncSource(200)),"s.c",nil); e!=nil; e = e.Next() { want = append(want,e.TokenText) }
+	
+	l := Synchronized(ScanWith(strings.NewReader(syncSource(200)),"s.c",nil))
+	const N = 8
+	walks := make([][]*Element,N)
+	var wg sync.WaitGroup
+	for i := range walks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for e := l; e!=nil; e = e.Next() { walks[i] = append(walks[i],e) }
+		}(i)
+	}
+	wg.Wait()
+	for i,w := range walks {
+		if len(w)!=len(want) { t.Fatalf("walk %d: %d elements, want %d",i,len(w),len(want)) }
+		for j,e := range w {
+			// Every element is materialized once, so all walks see the same elements.
+			if e!=walks[0][j] { t.Fatalf("walk %d: element %d differs",i,j) }
+			if e.TokenText!=want[j] { t.Fatalf("walk %d: element %d is %q, want %q",i,j,e.TokenText,want[j]) }
+		}
+	}
+	if Synchronized(nil)!=nil { t.Errorf("Synchronized(nil)!=nil") }
+}
+
+func BenchmarkNext(b *testing.B) {
+	src := syncSource(100)
+	for _,c := range []struct{ name string; wrap func(*Element) *Element }{
+		{"plain",func(e *Element) *Element { return e }},
+		{"synchronized",Synchronized},
+	}{
+		b.Run(c.name,func(b *testing.B) {
+			for i := 0; i<b.N; i++ {
+				b.StopTimer()
+				l := ScanWith(strings.NewReader(src),"s.c",nil)
+				b.StartTimer()
+				for e := c.wrap(l); e!=nil; e = e.Next() {}
+			}
+		})
+	}
+}
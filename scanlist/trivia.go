@@ -0,0 +1,132 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "text/scanner"
+import "strings"
+
+const (
+	TRIVIA_SPACE = uint(iota)
+	TRIVIA_NEWLINE
+	TRIVIA_LINE_COMMENT
+	TRIVIA_BLOCK_COMMENT
+)
+
+/*
+Whitespace or a comment. With BaseScanner.Trivia, every element gets the
+trivia before it (Leading) and the trivia after it up to and including the
+first newline (Trailing). The last element also gets the trivia at the end of
+the input. So the concatenation of FullText() of all elements is the input.
+If the input contains no token at all, its trivia is left in EOFTrivia.
+*/
+type Trivia struct{
+	Kind uint
+	Text string
+}
+
+// Returns the leading trivia, the token text (the source text for LEX_ERROR) and the trailing trivia.
+func (e *Element) FullText() string {
+	s := new(strings.Builder)
+	for _,t := range e.Leading { s.WriteString(t.Text) }
+	if e.Token==LEX_ERROR { s.WriteString(e.Raw) } else { s.WriteString(e.TokenText) }
+	for _,t := range e.Trailing { s.WriteString(t.Text) }
+	return s.String()
+}
+
+type triviaState struct{
+	ws uint64 // the original Whitespace of the scanner
+	ahead *Element // the next token, if it has already been scanned
+	lead []Trivia // the leading trivia of ahead
+}
+
+// Returns the trivia, e consists of, if any.
+func (b *BaseScanner) asTrivia(e *Element) (Trivia,bool) {
+	switch {
+	case e.Token==scanner.Comment && strings.HasPrefix(e.TokenText,"//"):
+		return Trivia{TRIVIA_LINE_COMMENT,e.TokenText},true
+	case e.Token==scanner.Comment:
+		return Trivia{TRIVIA_BLOCK_COMMENT,e.TokenText},true
+	case e.Token=='\n' && b.triv.ws&(1<<'\n')!=0:
+		return Trivia{TRIVIA_NEWLINE,e.TokenText},true
+	case e.Token>=0 && e.Token<64 && b.triv.ws&(1<<uint(e.Token))!=0:
+		return Trivia{TRIVIA_SPACE,e.TokenText},true
+	}
+	return Trivia{},false
+}
+
+// Appends t to ts, merging adjacent spaces.
+func appendTrivia(ts []Trivia,t Trivia) []Trivia {
+	if i := len(ts)-1; i>=0 && t.Kind==TRIVIA_SPACE && ts[i].Kind==TRIVIA_SPACE {
+		ts[i].Text += t.Text
+		return ts
+	}
+	return append(ts,t)
+}
+
+// Like scan(), but attaches the trivia.
+func (b *BaseScanner) trivia() *Element {
+	if b.triv==nil {
+		// Whitespace and comments are scanned as tokens.
+		b.triv = &triviaState{ws:b.Whitespace}
+		b.Whitespace = 0
+		b.Mode &^= scanner.SkipComments
+	}
+	st := b.triv
+	e := st.ahead
+	if e==nil { e = b.scan() }
+	lead := st.lead
+	st.ahead,st.lead = nil,nil
+	for ; e!=nil; e = b.scan() {
+		t,ok := b.asTrivia(e)
+		if !ok { break }
+		lead = appendTrivia(lead,t)
+	}
+	if e==nil {
+		b.EOFTrivia = append(b.EOFTrivia,lead...)
+		return nil
+	}
+	e.Leading = lead
+	nl := false
+	for {
+		n := b.scan()
+		if n==nil {
+			for _,t := range st.lead { e.Trailing = appendTrivia(e.Trailing,t) }
+			st.lead = nil
+			break
+		}
+		t,ok := b.asTrivia(n)
+		if !ok {
+			st.ahead = n
+			break
+		}
+		if nl {
+			st.lead = appendTrivia(st.lead,t)
+		} else {
+			e.Trailing = appendTrivia(e.Trailing,t)
+			nl = t.Kind==TRIVIA_NEWLINE
+		}
+	}
+	return e
+}
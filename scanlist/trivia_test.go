@@ -0,0 +1,70 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package scanlist
+
+import "strings"
+import "testing"
+
+// The FullText() of all elements (and the EOFTrivia) reproduces the input.
+func TestTriviaRoundTrip(t *testing.T) {
+	for _,src := range []string{
+		"a + b;\n",
+		"  // lead\n\tint a; /* c1 */ /* c2 */ // rest\n\n/* block\n comment */ b(c , d)\n   ",
+		"x = y;/**/z",
+		"",
+		"   \n\t ",
+		"// only a comment",
+		"/* a */ \n // b\n",
+		"x = \"abc;\n y;",
+		"a = 'ab'; // c\n",
+		"a /* unterminated",
+		"a + \xff; b",
+	}{
+		s := new(BaseScanner)
+		s.Init(strings.NewReader(src))
+		s.Trivia = true
+		b := new(strings.Builder)
+		for e := s.Next(); e!=nil; e = e.Next() { b.WriteString(e.FullText()) }
+		for _,tr := range s.EOFTrivia { b.WriteString(tr.Text) }
+		if b.String()!=src { t.Errorf("got %q, want %q",b.String(),src) }
+	}
+}
+
+// Trivia doesn't become tokens, and is classified.
+func TestTriviaKinds(t *testing.T) {
+	s := new(BaseScanner)
+	s.Init(strings.NewReader("/* a */ x // b\n\n  y"))
+	s.Trivia = true
+	x := s.Next()
+	y := x.Next()
+	if x.TokenText!="x" || y.TokenText!="y" || y.Next()!=nil { t.Fatalf("%q %q",x.TokenText,y.TokenText) }
+	kinds := func(ts []Trivia) (k []uint) {
+		for _,t := range ts { k = append(k,t.Kind) }
+		return
+	}
+	if k := kinds(x.Leading); len(k)!=2 || k[0]!=TRIVIA_BLOCK_COMMENT || k[1]!=TRIVIA_SPACE { t.Errorf("x leading %v",k) }
+	if k := kinds(x.Trailing); len(k)!=3 || k[1]!=TRIVIA_LINE_COMMENT || k[2]!=TRIVIA_NEWLINE { t.Errorf("x trailing %v",k) }
+	if k := kinds(y.Leading); len(k)!=2 || k[0]!=TRIVIA_NEWLINE || k[1]!=TRIVIA_SPACE { t.Errorf("y leading %v",k) }
+}